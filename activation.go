@@ -0,0 +1,245 @@
+package nnet
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Activation represents a transfer function of a layer. Activations operate
+// on a whole vector of units so that non element-wise functions such as
+// softmax can be expressed.
+type Activation interface {
+	// Name returns a name that identifies the activation (including its
+	// parameters, if any) in dump files. NewActivation(a.Name()) must
+	// return an equivalent activation.
+	Name() string
+
+	// Forward transforms pre-activations x into outputs in place.
+	Forward(x []float64)
+
+	// Backward transforms grad, the gradient with respect to the outputs
+	// y, into the gradient with respect to the pre-activations in place.
+	Backward(y, grad []float64)
+}
+
+// NewActivation returns the activation identified by name. The empty name
+// corresponds to sigmoid, which was the only transfer function available
+// in older dump files.
+func NewActivation(name string) (Activation, error) {
+	base, param, hasParam, err := parseName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch base {
+	case "", "sigmoid":
+		return SigmoidActivation{}, nil
+	case "tanh":
+		return TanhActivation{}, nil
+	case "relu":
+		return ReLU{}, nil
+	case "leaky_relu":
+		if !hasParam {
+			param = 0.01
+		}
+		return LeakyReLU{Alpha: param}, nil
+	case "elu":
+		if !hasParam {
+			param = 1.0
+		}
+		return ELU{Alpha: param}, nil
+	case "softplus":
+		return Softplus{}, nil
+	case "linear":
+		return Linear{}, nil
+	case "softmax":
+		return Softmax{}, nil
+	}
+
+	return nil, fmt.Errorf("nnet: unknown activation %q", name)
+}
+
+// parseName splits names of the form "base" or "base(param)".
+func parseName(name string) (string, float64, bool, error) {
+	i := strings.Index(name, "(")
+	if i < 0 {
+		return name, 0, false, nil
+	}
+	if !strings.HasSuffix(name, ")") {
+		return "", 0, false, fmt.Errorf("nnet: malformed name %q", name)
+	}
+	param, err := strconv.ParseFloat(name[i+1:len(name)-1], 64)
+	if err != nil {
+		return "", 0, false, fmt.Errorf("nnet: malformed name %q", name)
+	}
+	return name[:i], param, true, nil
+}
+
+func nameWithParam(base string, param float64) string {
+	return base + "(" + strconv.FormatFloat(param, 'g', -1, 64) + ")"
+}
+
+// SigmoidActivation is the logistic function 1/(1+exp(-x)).
+type SigmoidActivation struct{}
+
+func (SigmoidActivation) Name() string { return "sigmoid" }
+
+func (SigmoidActivation) Forward(x []float64) {
+	for i := range x {
+		x[i] = Sigmoid(x[i])
+	}
+}
+
+func (SigmoidActivation) Backward(y, grad []float64) {
+	for i := range grad {
+		grad[i] *= DSigmoid(y[i])
+	}
+}
+
+// TanhActivation is the hyperbolic tangent.
+type TanhActivation struct{}
+
+func (TanhActivation) Name() string { return "tanh" }
+
+func (TanhActivation) Forward(x []float64) {
+	for i := range x {
+		x[i] = Tanh(x[i])
+	}
+}
+
+func (TanhActivation) Backward(y, grad []float64) {
+	for i := range grad {
+		grad[i] *= DTanh(y[i])
+	}
+}
+
+// ReLU is the rectified linear unit max(0, x).
+type ReLU struct{}
+
+func (ReLU) Name() string { return "relu" }
+
+func (ReLU) Forward(x []float64) {
+	for i := range x {
+		if x[i] < 0 {
+			x[i] = 0
+		}
+	}
+}
+
+func (ReLU) Backward(y, grad []float64) {
+	for i := range grad {
+		if y[i] <= 0 {
+			grad[i] = 0
+		}
+	}
+}
+
+// LeakyReLU is x for x > 0 and Alpha*x otherwise. Alpha is expected to be
+// positive.
+type LeakyReLU struct {
+	Alpha float64
+}
+
+func (a LeakyReLU) Name() string { return nameWithParam("leaky_relu", a.Alpha) }
+
+func (a LeakyReLU) Forward(x []float64) {
+	for i := range x {
+		if x[i] < 0 {
+			x[i] *= a.Alpha
+		}
+	}
+}
+
+func (a LeakyReLU) Backward(y, grad []float64) {
+	for i := range grad {
+		if y[i] <= 0 {
+			grad[i] *= a.Alpha
+		}
+	}
+}
+
+// ELU is the exponential linear unit, x for x > 0 and Alpha*(exp(x)-1)
+// otherwise.
+type ELU struct {
+	Alpha float64
+}
+
+func (a ELU) Name() string { return nameWithParam("elu", a.Alpha) }
+
+func (a ELU) Forward(x []float64) {
+	for i := range x {
+		if x[i] < 0 {
+			x[i] = a.Alpha * (math.Exp(x[i]) - 1.0)
+		}
+	}
+}
+
+func (a ELU) Backward(y, grad []float64) {
+	for i := range grad {
+		if y[i] <= 0 {
+			// d/dx alpha*(exp(x)-1) = alpha*exp(x) = y + alpha
+			grad[i] *= y[i] + a.Alpha
+		}
+	}
+}
+
+// Softplus is the smooth approximation of ReLU log(1+exp(x)).
+type Softplus struct{}
+
+func (Softplus) Name() string { return "softplus" }
+
+func (Softplus) Forward(x []float64) {
+	for i := range x {
+		// log(1+exp(x)) = max(x, 0) + log(1+exp(-|x|)) avoids overflow
+		x[i] = math.Max(x[i], 0) + math.Log1p(math.Exp(-math.Abs(x[i])))
+	}
+}
+
+func (Softplus) Backward(y, grad []float64) {
+	for i := range grad {
+		// d/dx log(1+exp(x)) = sigmoid(x) = 1 - exp(-y)
+		grad[i] *= -math.Expm1(-y[i])
+	}
+}
+
+// Linear is the identity function.
+type Linear struct{}
+
+func (Linear) Name() string { return "linear" }
+
+func (Linear) Forward(x []float64) {}
+
+func (Linear) Backward(y, grad []float64) {}
+
+// Softmax normalizes a vector into a probability distribution,
+// exp(x_i)/sum_j exp(x_j).
+type Softmax struct{}
+
+func (Softmax) Name() string { return "softmax" }
+
+func (Softmax) Forward(x []float64) {
+	max := -math.MaxFloat64
+	for _, v := range x {
+		if v > max {
+			max = v
+		}
+	}
+	sum := 0.0
+	for i := range x {
+		x[i] = math.Exp(x[i] - max)
+		sum += x[i]
+	}
+	for i := range x {
+		x[i] /= sum
+	}
+}
+
+func (Softmax) Backward(y, grad []float64) {
+	// Jacobian-vector product: y_i * (g_i - sum_j g_j y_j)
+	s := Dot(grad, y)
+	for i := range grad {
+		grad[i] = y[i] * (grad[i] - s)
+	}
+}
@@ -0,0 +1,52 @@
+package nnet
+
+import (
+	"math"
+	"testing"
+)
+
+func TestActivationBackward(t *testing.T) {
+	activations := []Activation{
+		SigmoidActivation{}, TanhActivation{}, ReLU{}, LeakyReLU{Alpha: 0.1},
+		ELU{Alpha: 1.0}, Softplus{}, Linear{}, Softmax{},
+	}
+	x := []float64{-1.3, -0.2, 0.4, 2.1}
+	weight := []float64{0.3, -1.0, 0.7, 0.2} // L = sum_i weight_i * y_i
+	eps := 1.0e-6
+
+	for _, a := range activations {
+		y := append([]float64(nil), x...)
+		a.Forward(y)
+		grad := append([]float64(nil), weight...)
+		a.Backward(y, grad)
+
+		for i := range x {
+			xp := append([]float64(nil), x...)
+			xm := append([]float64(nil), x...)
+			xp[i] += eps
+			xm[i] -= eps
+			a.Forward(xp)
+			a.Forward(xm)
+			numerical := (Dot(weight, xp) - Dot(weight, xm)) / (2 * eps)
+			if math.Abs(numerical-grad[i]) > 1.0e-6 {
+				t.Errorf("%s: gradient %f at %d, want %f.",
+					a.Name(), grad[i], i, numerical)
+			}
+		}
+	}
+}
+
+func TestNewActivation(t *testing.T) {
+	for _, a := range []Activation{ReLU{}, LeakyReLU{Alpha: 0.25}, ELU{Alpha: 0.5}} {
+		b, err := NewActivation(a.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b != a {
+			t.Errorf("NewActivation(%q) returns %v, want %v.", a.Name(), b, a)
+		}
+	}
+	if _, err := NewActivation("unknown"); err == nil {
+		t.Errorf("NewActivation returns nil error for unknown name.")
+	}
+}
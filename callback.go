@@ -0,0 +1,164 @@
+package nnet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Metrics holds named values that describe the progress of training, e.g.
+// "objective" at the end of an epoch or "learning_rate" after a mini-batch.
+type Metrics map[string]float64
+
+// ErrStopTraining can be returned by callbacks to stop training early.
+// Training then ends without error after OnTrainEnd has been called.
+var ErrStopTraining = errors.New("nnet: stop training")
+
+// Callback receives the progress of training. model is the model being
+// trained. If a hook returns an error other than ErrStopTraining, training
+// is aborted and the error is returned by the Train method.
+type Callback interface {
+	OnEpochBegin(model interface{}, epoch int) error
+	OnBatchEnd(model interface{}, epoch, batch int, metrics Metrics) error
+	OnEpochEnd(model interface{}, epoch int, metrics Metrics) error
+
+	// OnTrainEnd is called with the metrics of the last epoch, also when
+	// training is cancelled.
+	OnTrainEnd(model interface{}, metrics Metrics) error
+}
+
+// BaseCallback implements all hooks of Callback as no-ops. Embed it to
+// implement only some of them.
+type BaseCallback struct{}
+
+func (BaseCallback) OnEpochBegin(model interface{}, epoch int) error {
+	return nil
+}
+
+func (BaseCallback) OnBatchEnd(model interface{}, epoch, batch int,
+	metrics Metrics) error {
+	return nil
+}
+
+func (BaseCallback) OnEpochEnd(model interface{}, epoch int,
+	metrics Metrics) error {
+	return nil
+}
+
+func (BaseCallback) OnTrainEnd(model interface{}, metrics Metrics) error {
+	return nil
+}
+
+// Callbacks calls a list of callbacks in order. A hook stops at the first
+// error.
+type Callbacks []Callback
+
+func (cs Callbacks) OnEpochBegin(model interface{}, epoch int) error {
+	for _, c := range cs {
+		if err := c.OnEpochBegin(model, epoch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cs Callbacks) OnBatchEnd(model interface{}, epoch, batch int,
+	metrics Metrics) error {
+	for _, c := range cs {
+		if err := c.OnBatchEnd(model, epoch, batch, metrics); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cs Callbacks) OnEpochEnd(model interface{}, epoch int,
+	metrics Metrics) error {
+	for _, c := range cs {
+		if err := c.OnEpochEnd(model, epoch, metrics); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cs Callbacks) OnTrainEnd(model interface{}, metrics Metrics) error {
+	for _, c := range cs {
+		if err := c.OnTrainEnd(model, metrics); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Printer writes "epoch objective" to W at the end of every epoch, followed
+// by the gradient norms averaged over the epoch as "name=value" if they are
+// reported. It is used for the Monitoring option of training.
+type Printer struct {
+	BaseCallback
+	W     io.Writer
+	norms gradNorms
+}
+
+func (p *Printer) OnEpochBegin(model interface{}, epoch int) error {
+	p.norms.reset()
+	return nil
+}
+
+func (p *Printer) OnBatchEnd(model interface{}, epoch, batch int,
+	metrics Metrics) error {
+	p.norms.add(metrics)
+	return nil
+}
+
+func (p *Printer) OnEpochEnd(model interface{}, epoch int,
+	metrics Metrics) error {
+	line := fmt.Sprint(epoch, " ", metrics["objective"])
+	means := p.norms.means()
+	names := make([]string, 0, len(means))
+	for name := range means {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		line += fmt.Sprintf(" %s=%g", name, means[name])
+	}
+	_, err := fmt.Fprintln(p.W, line)
+	return err
+}
+
+// gradNormKey is the prefix of the metrics of gradient norms.
+const gradNormKey = "grad_norm"
+
+// gradNorms averages the gradient norms reported after mini-batches.
+type gradNorms struct {
+	sums   Metrics
+	counts map[string]int
+}
+
+func (g *gradNorms) reset() {
+	g.sums, g.counts = nil, nil
+}
+
+func (g *gradNorms) add(metrics Metrics) {
+	for k, v := range metrics {
+		if !strings.HasPrefix(k, gradNormKey) {
+			continue
+		}
+		if g.sums == nil {
+			g.sums, g.counts = Metrics{}, map[string]int{}
+		}
+		g.sums[k] += v
+		g.counts[k]++
+	}
+}
+
+func (g *gradNorms) means() Metrics {
+	means := Metrics{}
+	for k, sum := range g.sums {
+		means[k] = sum / float64(g.counts[k])
+	}
+	return means
+}
@@ -0,0 +1,298 @@
+package nnet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// recorder records hooks and stops training after StopEpoch.
+type recorder struct {
+	StopEpoch int
+	Err       error
+	events    []string
+}
+
+func (r *recorder) OnEpochBegin(model interface{}, epoch int) error {
+	r.events = append(r.events, fmt.Sprint("begin ", epoch))
+	return nil
+}
+
+func (r *recorder) OnBatchEnd(model interface{}, epoch, batch int,
+	metrics Metrics) error {
+	r.events = append(r.events, fmt.Sprint("batch ", epoch, batch))
+	return nil
+}
+
+func (r *recorder) OnEpochEnd(model interface{}, epoch int,
+	metrics Metrics) error {
+	r.events = append(r.events, fmt.Sprint("end ", epoch, metrics["objective"]))
+	if epoch == r.StopEpoch {
+		return r.Err
+	}
+	return nil
+}
+
+func (r *recorder) OnTrainEnd(model interface{}, metrics Metrics) error {
+	r.events = append(r.events, "train end")
+	return nil
+}
+
+func TestTrainerCallbacks(t *testing.T) {
+	r := &recorder{StopEpoch: 1, Err: ErrStopTraining}
+	trainer := NewTrainer(BaseTrainingOption{
+		Epoches:       3,
+		MiniBatchSize: 2,
+		Callbacks:     []Callback{r},
+	})
+	if err := trainer.UnSupervisedMiniBatchTrain(&scheduledModel{},
+		MakeMatrix(4, 1)); err != nil {
+		t.Fatalf("Train returns %v, want no error.", err)
+	}
+
+	want := []string{
+		"begin 0", "batch 0 0", "batch 0 1", "end 0 0",
+		"begin 1", "batch 1 0", "batch 1 1", "end 1 0",
+		"train end",
+	}
+	if !reflect.DeepEqual(r.events, want) {
+		t.Errorf("Callbacks are called as %v, want %v.", r.events, want)
+	}
+}
+
+func TestTrainerCallbackError(t *testing.T) {
+	failure := errors.New("failure")
+	r := &recorder{StopEpoch: 0, Err: failure}
+	trainer := NewTrainer(BaseTrainingOption{
+		Epoches:       3,
+		MiniBatchSize: 2,
+		Callbacks:     []Callback{r},
+	})
+	err := trainer.UnSupervisedMiniBatchTrain(&scheduledModel{},
+		MakeMatrix(4, 1))
+	if err != failure {
+		t.Errorf("Train returns %v, want %v.", err, failure)
+	}
+	if last := r.events[len(r.events)-1]; last != "end 0 0" {
+		t.Errorf("Last callback is %q, want %q.", last, "end 0 0")
+	}
+}
+
+// counterModel increments its only parameter on every update and has the
+// minimum objective at 4.
+type counterModel struct {
+	value   []float64
+	updates int
+}
+
+func (m *counterModel) Params() []*Param {
+	return []*Param{{Name: "value", Value: m.value, Grad: []float64{0}}}
+}
+
+func (m *counterModel) UnSupervisedMiniBatchUpdate(input [][]float64,
+	epoch, miniBatchIndex int) {
+	m.value[0]++
+	m.updates++
+}
+
+func (m *counterModel) UnSupervisedObjective(input [][]float64) float64 {
+	return math.Abs(m.value[0] - 4)
+}
+
+func TestTrainerEarlyStopping(t *testing.T) {
+	m := &counterModel{value: []float64{0}}
+	trainer := NewTrainer(BaseTrainingOption{
+		Epoches:         10,
+		MiniBatchSize:   2,
+		ValidationInput: MakeMatrix(1, 1),
+		Patience:        2,
+	})
+	if err := trainer.UnSupervisedMiniBatchTrain(m, MakeMatrix(4, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The best epoch is the second one, followed by two worse epochs.
+	if m.updates != 8 {
+		t.Errorf("Training performs %d updates, want 8.", m.updates)
+	}
+	if m.value[0] != 4 {
+		t.Errorf("Restored parameter is %v, want 4.", m.value[0])
+	}
+}
+
+// batchRecorder records mini-batches.
+type batchRecorder struct {
+	scheduledModel
+	batches [][]float64
+}
+
+func (m *batchRecorder) UnSupervisedMiniBatchUpdate(input [][]float64,
+	epoch, miniBatchIndex int) {
+	var batch []float64
+	for _, x := range input {
+		batch = append(batch, x[0])
+	}
+	m.batches = append(m.batches, batch)
+}
+
+func TestTrainerMiniBatches(t *testing.T) {
+	input := [][]float64{{0}, {1}, {2}, {3}, {4}}
+
+	m := &batchRecorder{}
+	trainer := NewTrainer(BaseTrainingOption{Epoches: 1, MiniBatchSize: 2})
+	if err := trainer.UnSupervisedMiniBatchTrain(m, input); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]float64{{0, 1}, {2, 3}, {4}}
+	if !reflect.DeepEqual(m.batches, want) {
+		t.Errorf("Mini-batches are %v, want %v.", m.batches, want)
+	}
+
+	// Shuffled data is visited once per epoch in a reproducible order
+	var orders [2][][]float64
+	for i := range orders {
+		m := &batchRecorder{}
+		trainer := NewTrainer(BaseTrainingOption{Epoches: 2, MiniBatchSize: 2,
+			Shuffle: true, Seed: 1})
+		if err := trainer.UnSupervisedMiniBatchTrain(m, input); err != nil {
+			t.Fatal(err)
+		}
+		orders[i] = m.batches
+		if len(m.batches) != 6 {
+			t.Fatalf("Number of mini-batches is %d, want 6.", len(m.batches))
+		}
+		seen := make(map[float64]bool)
+		for _, batch := range m.batches[:3] {
+			for _, x := range batch {
+				seen[x] = true
+			}
+		}
+		if len(seen) != len(input) {
+			t.Errorf("First epoch visits %v, want all of %v.", m.batches[:3], input)
+		}
+	}
+	if !reflect.DeepEqual(orders[0], orders[1]) {
+		t.Errorf("Shuffled orders differ with the same seed: %v and %v.",
+			orders[0], orders[1])
+	}
+
+	for _, size := range []int{0, 6} {
+		trainer := NewTrainer(BaseTrainingOption{Epoches: 1, MiniBatchSize: size})
+		if err := trainer.UnSupervisedMiniBatchTrain(m, input); err == nil {
+			t.Errorf("Training with mini-batch size %d returns no error.", size)
+		}
+	}
+}
+
+// canceler cancels training after a number of mini-batches.
+type canceler struct {
+	BaseCallback
+	cancel  context.CancelFunc
+	batches int
+}
+
+func (c *canceler) OnBatchEnd(model interface{}, epoch, batch int,
+	metrics Metrics) error {
+	c.batches--
+	if c.batches == 0 {
+		c.cancel()
+	}
+	return nil
+}
+
+func TestTrainerContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := &batchRecorder{}
+	trainer := NewTrainer(BaseTrainingOption{
+		Epoches:       3,
+		MiniBatchSize: 1,
+		Callbacks:     []Callback{&canceler{cancel: cancel, batches: 3}},
+	})
+	err := trainer.UnSupervisedMiniBatchTrainContext(ctx, m, MakeMatrix(2, 1))
+	if err != context.Canceled {
+		t.Errorf("Train returns %v, want %v.", err, context.Canceled)
+	}
+	if len(m.batches) != 3 {
+		t.Errorf("Training performs %d updates, want 3.", len(m.batches))
+	}
+}
+
+// epochCanceler cancels training at the end of an epoch and records the
+// hooks called.
+type epochCanceler struct {
+	BaseCallback
+	cancel context.CancelFunc
+	epoch  int
+	begins int
+	ended  bool
+}
+
+func (c *epochCanceler) OnEpochBegin(model interface{}, epoch int) error {
+	c.begins++
+	return nil
+}
+
+func (c *epochCanceler) OnEpochEnd(model interface{}, epoch int,
+	metrics Metrics) error {
+	if epoch == c.epoch {
+		c.cancel()
+	}
+	return nil
+}
+
+func (c *epochCanceler) OnTrainEnd(model interface{}, metrics Metrics) error {
+	c.ended = true
+	return nil
+}
+
+func TestTrainerContextRestore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := &counterModel{value: []float64{0}}
+	c := &epochCanceler{cancel: cancel, epoch: 2}
+	trainer := NewTrainer(BaseTrainingOption{
+		Epoches:         10,
+		MiniBatchSize:   2,
+		ValidationInput: MakeMatrix(1, 1),
+		Callbacks:       []Callback{c},
+	})
+	err := trainer.UnSupervisedMiniBatchTrainContext(ctx, m, MakeMatrix(4, 1))
+	if err != context.Canceled {
+		t.Errorf("Train returns %v, want %v.", err, context.Canceled)
+	}
+	if c.begins != 3 {
+		t.Errorf("OnEpochBegin is called %d times, want 3.", c.begins)
+	}
+	if !c.ended {
+		t.Errorf("OnTrainEnd is not called.")
+	}
+	// The best epoch is the second one.
+	if m.value[0] != 4 {
+		t.Errorf("Restored parameter is %v, want 4.", m.value[0])
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	var buf bytes.Buffer
+	trainer := NewTrainer(BaseTrainingOption{
+		Epoches:       2,
+		MiniBatchSize: 2,
+		Callbacks:     []Callback{&Printer{W: &buf}},
+	})
+	m := &counterModel{value: []float64{0}}
+	if err := trainer.UnSupervisedMiniBatchTrain(m, MakeMatrix(4, 1)); err != nil {
+		t.Fatal(err)
+	}
+	want := "0 2 grad_norm=0 grad_norm/value=0\n" +
+		"1 0 grad_norm=0 grad_norm/value=0\n"
+	if buf.String() != want {
+		t.Errorf("Printer writes %q, want %q.", buf.String(), want)
+	}
+}
@@ -0,0 +1,126 @@
+package nnet
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"os"
+)
+
+// Checkpointer is implemented by models whose training state can be saved
+// in checkpoints by Trainer.
+type Checkpointer interface {
+	// Checkpoint returns the training state of the model, i.e. parameters,
+	// optimizer state and anything else that is updated during training.
+	// It reseeds the random number generator of the model by ReseedRand and
+	// saves the seed, so that a resumed run draws the same numbers as the
+	// original one.
+	Checkpoint() ([]byte, error)
+
+	// RestoreCheckpoint restores a state returned by Checkpoint.
+	RestoreCheckpoint(b []byte) error
+}
+
+// ReseedRand draws a seed from rng, reseeds rng with it and returns the
+// seed. The state of a generator can't be read, but a generator created by
+// NewRand(seed) continues exactly like rng afterwards.
+func ReseedRand(rng *rand.Rand) int64 {
+	seed := rng.Int63()
+	rng.Seed(seed)
+	return seed
+}
+
+// checkpoint is the content of a checkpoint file.
+type checkpoint struct {
+	Epoch      int // number of finished epochs
+	Iteration  int // number of finished updates
+	Model      json.RawMessage
+	Schedule   json.RawMessage  `json:",omitempty"`
+	Validation *validationState `json:",omitempty"`
+}
+
+type validationState struct {
+	Best  [][]float64
+	Score float64
+	Wait  int
+}
+
+// checkCheckpoint returns an error if u can't be checkpointed.
+func (s *Trainer) checkCheckpoint(u interface{}) error {
+	if s.Option.Checkpoint == "" {
+		return nil
+	}
+	if _, ok := u.(Checkpointer); !ok {
+		return errors.New("Training state of the model can't be saved.")
+	}
+	return nil
+}
+
+// saveCheckpoint writes a checkpoint after the given number of epochs if it
+// is due.
+func (s *Trainer) saveCheckpoint(u interface{}, epoch, iteration int,
+	v *validation) error {
+	every := s.Option.CheckpointEvery
+	if every <= 0 {
+		every = 1
+	}
+	if s.Option.Checkpoint == "" || epoch%every != 0 {
+		return nil
+	}
+
+	model, err := u.(Checkpointer).Checkpoint()
+	if err != nil {
+		return err
+	}
+	c := checkpoint{Epoch: epoch, Iteration: iteration, Model: model}
+	if s.Option.Schedule != nil {
+		if c.Schedule, err = json.Marshal(s.Option.Schedule); err != nil {
+			return err
+		}
+	}
+	if v != nil && v.seen {
+		c.Validation = &validationState{Best: v.best, Score: v.score,
+			Wait: v.wait}
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that a crash while writing does
+	// not destroy the previous checkpoint.
+	tmp := s.Option.Checkpoint + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Option.Checkpoint)
+}
+
+// Resume restores a checkpoint written during training into u and the
+// trainer. The next call of a Train method continues the checkpointed run
+// from the epoch after the checkpoint. The trainer must be created with the
+// options of the original run, including a schedule of the same type.
+func (s *Trainer) Resume(filename string, u Checkpointer) error {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var c checkpoint
+	if err := json.Unmarshal(b, &c); err != nil {
+		return err
+	}
+
+	if err := u.RestoreCheckpoint(c.Model); err != nil {
+		return err
+	}
+	if c.Schedule != nil {
+		if s.Option.Schedule == nil {
+			return errors.New("Checkpoint has a schedule, but training has none.")
+		}
+		if err := json.Unmarshal(c.Schedule, s.Option.Schedule); err != nil {
+			return err
+		}
+	}
+	s.resumed = &c
+	return nil
+}
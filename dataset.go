@@ -0,0 +1,175 @@
+package nnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+)
+
+// Dataset is a collection of samples that Trainer reads mini-batch by
+// mini-batch, so that the whole data doesn't have to be kept in memory.
+type Dataset interface {
+	// Len returns the number of samples.
+	Len() int
+
+	// Batch returns the inputs and the targets of the samples at indices.
+	// target is nil for unlabeled data. The returned slices must not be
+	// modified by the caller.
+	Batch(indices []int) (input, target [][]float64, err error)
+}
+
+// InMemory is a dataset of in-memory samples. Target may be nil.
+type InMemory struct {
+	Input  [][]float64
+	Target [][]float64
+}
+
+// NewInMemory returns a dataset of input and target, which may be nil.
+func NewInMemory(input, target [][]float64) (*InMemory, error) {
+	if target != nil && len(target) != len(input) {
+		return nil, errors.New("Numbers of input and target data differ.")
+	}
+	return &InMemory{Input: input, Target: target}, nil
+}
+
+func (d *InMemory) Len() int {
+	return len(d.Input)
+}
+
+func (d *InMemory) Batch(indices []int) ([][]float64, [][]float64, error) {
+	input := make([][]float64, len(indices))
+	for i, index := range indices {
+		input[i] = d.Input[index]
+	}
+	if d.Target == nil {
+		return input, nil, nil
+	}
+	target := make([][]float64, len(indices))
+	for i, index := range indices {
+		target[i] = d.Target[index]
+	}
+	return input, target, nil
+}
+
+// Lazy is a dataset whose samples are loaded on demand by Load, e.g. from
+// files. Load returns a nil target for unlabeled data.
+type Lazy struct {
+	N    int
+	Load func(index int) (input, target []float64, err error)
+}
+
+func (d *Lazy) Len() int {
+	return d.N
+}
+
+func (d *Lazy) Batch(indices []int) ([][]float64, [][]float64, error) {
+	input := make([][]float64, len(indices))
+	var target [][]float64
+	for i, index := range indices {
+		x, t, err := d.Load(index)
+		if err != nil {
+			return nil, nil, err
+		}
+		input[i] = x
+		if t != nil {
+			if target == nil {
+				target = make([][]float64, len(indices))
+			}
+			target[i] = t
+		}
+	}
+	return input, target, nil
+}
+
+// NewFloat32File returns a lazy dataset reading samples from r, which holds
+// n records written by WriteFloat32Records. Each record is inputDim values
+// of input followed by targetDim values of target as little endian float32,
+// which takes half the memory of float64 when the file is loaded on demand
+// or mapped.
+func NewFloat32File(r io.ReaderAt, n, inputDim, targetDim int) *Lazy {
+	dim := inputDim + targetDim
+	return &Lazy{N: n, Load: func(index int) ([]float64, []float64, error) {
+		b := make([]byte, 4*dim)
+		if _, err := r.ReadAt(b, int64(index)*int64(len(b))); err != nil {
+			return nil, nil, fmt.Errorf("nnet: reading sample %d: %v",
+				index, err)
+		}
+		v := make([]float64, dim)
+		for i := range v {
+			v[i] = float64(math.Float32frombits(
+				binary.LittleEndian.Uint32(b[4*i:])))
+		}
+		if targetDim == 0 {
+			return v, nil, nil
+		}
+		return v[:inputDim:inputDim], v[inputDim:], nil
+	}}
+}
+
+// WriteFloat32Records writes samples in the format read by NewFloat32File.
+// target may be nil.
+func WriteFloat32Records(w io.Writer, input, target [][]float64) error {
+	if target != nil && len(target) != len(input) {
+		return errors.New("Numbers of input and target data differ.")
+	}
+	var b []byte
+	for n := range input {
+		b = b[:0]
+		values := input[n]
+		if target != nil {
+			values = append(values[:len(values):len(values)], target[n]...)
+		}
+		for _, x := range values {
+			b = binary.LittleEndian.AppendUint32(b,
+				math.Float32bits(float32(x)))
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Generator is a dataset of N samples drawn by Generate whenever a batch is
+// requested, e.g. for synthetic data or on-the-fly augmentation. Samples
+// differ between epochs, so indices only determine the batch size.
+// Generate returns a nil target for unlabeled data.
+type Generator struct {
+	N        int
+	Generate func(rng *rand.Rand) (input, target []float64)
+
+	rng *rand.Rand
+}
+
+// NewGenerator returns a generator of n samples per epoch drawing from a
+// random number generator seeded by seed.
+func NewGenerator(n int, seed int64,
+	generate func(rng *rand.Rand) ([]float64, []float64)) *Generator {
+	return &Generator{N: n, Generate: generate, rng: NewRand(seed)}
+}
+
+func (d *Generator) Len() int {
+	return d.N
+}
+
+func (d *Generator) Batch(indices []int) ([][]float64, [][]float64, error) {
+	if d.rng == nil {
+		d.rng = DefaultRand(nil)
+	}
+	input := make([][]float64, len(indices))
+	var target [][]float64
+	for i := range indices {
+		x, t := d.Generate(d.rng)
+		input[i] = x
+		if t != nil {
+			if target == nil {
+				target = make([][]float64, len(indices))
+			}
+			target[i] = t
+		}
+	}
+	return input, target, nil
+}
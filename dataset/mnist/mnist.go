@@ -128,6 +128,17 @@ func PrepareX(M [][]byte) [][]float64 {
 	return result
 }
 
+// OneHot returns one-hot target vectors of labels for training with
+// cross-entropy, e.g. by a softmax output layer.
+func OneHot(N []byte) [][]float64 {
+	result := make([][]float64, len(N))
+	for i := range result {
+		result[i] = make([]float64, 10)
+		result[i][N[i]] = 1.0
+	}
+	return result
+}
+
 func PrepareY(N []byte) [][]float64 {
 	result := make([][]float64, len(N))
 	for i := 0; i < len(result); i++ {
@@ -0,0 +1,100 @@
+package nnet
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestInMemory(t *testing.T) {
+	d, err := NewInMemory([][]float64{{0}, {1}, {2}}, [][]float64{{3}, {4}, {5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, target, err := d.Batch([]int{2, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(input, [][]float64{{2}, {0}}) ||
+		!reflect.DeepEqual(target, [][]float64{{5}, {3}}) {
+		t.Errorf("Batch returns %v and %v, want [[2] [0]] and [[5] [3]].",
+			input, target)
+	}
+
+	if _, err := NewInMemory([][]float64{{0}}, [][]float64{}); err == nil {
+		t.Errorf("NewInMemory with different lengths returns no error.")
+	}
+}
+
+func TestFloat32File(t *testing.T) {
+	input := [][]float64{{0.5, -1}, {2, 0.25}, {-3, 4}}
+	target := [][]float64{{1}, {0}, {1}}
+	var buf bytes.Buffer
+	if err := WriteFloat32Records(&buf, input, target); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 3*3*4 {
+		t.Fatalf("File has %d bytes, want 36.", buf.Len())
+	}
+
+	d := NewFloat32File(bytes.NewReader(buf.Bytes()), 3, 2, 1)
+	x, y, err := d.Batch([]int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x, input[1:]) || !reflect.DeepEqual(y, target[1:]) {
+		t.Errorf("Batch returns %v and %v, want %v and %v.", x, y,
+			input[1:], target[1:])
+	}
+
+	if _, _, err := d.Batch([]int{3}); err == nil {
+		t.Errorf("Batch beyond the end of file returns no error.")
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	d := NewGenerator(4, 1, func(rng *rand.Rand) ([]float64, []float64) {
+		return []float64{rng.Float64()}, nil
+	})
+	a, target, _ := d.Batch([]int{0, 1})
+	b, _, _ := d.Batch([]int{0, 1})
+	if len(a) != 2 || target != nil {
+		t.Fatalf("Batch returns %v and %v, want 2 inputs and no target.", a,
+			target)
+	}
+	if reflect.DeepEqual(a, b) {
+		t.Errorf("Generator returns the same samples %v twice.", a)
+	}
+}
+
+func TestTrainerDataset(t *testing.T) {
+	input := [][]float64{{0}, {1}, {2}, {3}, {4}}
+	option := BaseTrainingOption{Epoches: 2, MiniBatchSize: 2, Shuffle: true,
+		Seed: 1}
+
+	// Datasets are visited in the same order as in-memory data
+	want := &batchRecorder{}
+	if err := NewTrainer(option).UnSupervisedMiniBatchTrain(want, input); err != nil {
+		t.Fatal(err)
+	}
+	m := &batchRecorder{}
+	lazy := &Lazy{N: len(input), Load: func(i int) ([]float64, []float64, error) {
+		return input[i], nil, nil
+	}}
+	if err := NewTrainer(option).UnSupervisedMiniBatchTrainDataset(m, lazy); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m.batches, want.batches) {
+		t.Errorf("Mini-batches are %v, want %v.", m.batches, want.batches)
+	}
+
+	errLoad := errors.New("load error")
+	lazy.Load = func(i int) ([]float64, []float64, error) {
+		return nil, nil, errLoad
+	}
+	if err := NewTrainer(option).UnSupervisedMiniBatchTrainDataset(m, lazy); err != errLoad {
+		t.Errorf("Training returns %v, want %v.", err, errLoad)
+	}
+}
@@ -2,43 +2,40 @@
 package dbn
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/r9y9/nnet"
 	"github.com/r9y9/nnet/rbm"
+	"math/rand"
 	"os"
+	"path/filepath"
 )
 
 // DBN represents Deep Belief Networks.
 type DBN struct {
 	RBMs      []*rbm.RBM
 	NumLayers int
+	rng       *rand.Rand
 }
 
 type PreTrainingOption struct {
 	rbm.TrainingOption
 }
 
-func New() *DBN {
-	return &DBN{}
+// New creates a new DBN instance. rng is shared by all RBMs added by
+// AddLayer; if it is nil, a generator seeded by the current time is used.
+func New(rng *rand.Rand) *DBN {
+	return &DBN{rng: nnet.DefaultRand(rng)}
 }
 
 // Load loads RBM from a dump file and return its instatnce.
 func Load(filename string) (*DBN, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	decoder := json.NewDecoder(file)
 	d := &DBN{}
-	err = decoder.Decode(d)
-
-	if err != nil {
+	if err := nnet.LoadFile(filename, d); err != nil {
 		return nil, err
 	}
-
 	return d, nil
 }
 
@@ -47,52 +44,290 @@ func (d *DBN) Dump(filename string) error {
 	return nnet.DumpAsJson(filename, d)
 }
 
-func (d *DBN) AddLayer(numVisibleUnits, numHiddenUnits int) {
-	if d.RBMs != nil {
-		// Get the number of visible units of new layer
-		r := d.RBMs[len(d.RBMs)-1] // last layer
-		numVisibleUnitsOfNewLayer := r.NumHiddenUnits
+func init() {
+	nnet.RegisterModel("dbn", func() nnet.Model { return &DBN{} })
+}
+
+// Kind implements nnet.Model.
+func (d *DBN) Kind() string {
+	return "dbn"
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. Each RBM is encoded by
+// rbm.RBM.MarshalBinary.
+func (d *DBN) MarshalBinary() ([]byte, error) {
+	var e nnet.BinaryEncoder
+	e.Int(len(d.RBMs))
+	for _, r := range d.RBMs {
+		b, err := r.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		e.String(string(b))
+	}
+	return e.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (d *DBN) UnmarshalBinary(b []byte) error {
+	dec := nnet.NewBinaryDecoder(b)
+	numLayers := dec.Int()
+	var rbms []*rbm.RBM
+	for i := 0; i < numLayers; i++ {
+		payload := dec.String()
+		if dec.Err() != nil {
+			break
+		}
+		r := &rbm.RBM{}
+		if err := r.UnmarshalBinary([]byte(payload)); err != nil {
+			return err
+		}
+		rbms = append(rbms, r)
+	}
+	if err := dec.Finish(); err != nil {
+		return err
+	}
+	d.RBMs, d.NumLayers = rbms, len(rbms)
+	return nil
+}
+
+// Forward propagates input through all RBMs and returns the activation of
+// the top hidden layer.
+func (d *DBN) Forward(input []float64) []float64 {
+	predicted := input
+	for _, r := range d.RBMs {
+		predicted = r.Forward(predicted)
+	}
+	return predicted
+}
+
+// ForwardBatch performs Forward for all inputs concurrently.
+func (d *DBN) ForwardBatch(input [][]float64) [][]float64 {
+	return nnet.ForwardBatch(d, input)
+}
 
-		if numVisibleUnits != numVisibleUnitsOfNewLayer {
-			panic("unexpected!")
+// AddLayer adds a new RBM layer. It returns a *nnet.ShapeError if
+// numVisibleUnits differs from the number of hidden units of the last layer.
+func (d *DBN) AddLayer(numVisibleUnits, numHiddenUnits int) error {
+	if n := len(d.RBMs); n > 0 {
+		// The visible units of the new layer are the hidden units of the
+		// last layer
+		err := nnet.CheckSize(fmt.Sprintf("layer %d visible units", n),
+			d.RBMs[n-1].NumHiddenUnits, numVisibleUnits)
+		if err != nil {
+			return err
 		}
 	}
 
 	// Add new RBM layer
-	newRbm := rbm.New(numVisibleUnits, numHiddenUnits)
+	newRbm := rbm.New(numVisibleUnits, numHiddenUnits, nil, d.rng)
 	d.RBMs = append(d.RBMs, newRbm)
 	d.NumLayers++
+	return nil
+}
+
+var errNoLayers = errors.New("dbn: no layers")
+
+// Validate implements nnet.Validator. It checks the parameters of all RBMs
+// and that adjacent layers fit.
+func (d *DBN) Validate() error {
+	for i, r := range d.RBMs {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("dbn: layer %d: %w", i, err)
+		}
+		if i == 0 {
+			continue
+		}
+		err := nnet.CheckSize(fmt.Sprintf("layer %d visible units", i),
+			d.RBMs[i-1].NumHiddenUnits, r.NumVisibleUnits)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Predict is like Forward but returns an error instead of panicking if
+// input doesn't match the network.
+func (d *DBN) Predict(input []float64) ([]float64, error) {
+	if len(d.RBMs) == 0 {
+		return nil, errNoLayers
+	}
+	err := nnet.CheckSize("input", d.RBMs[0].NumVisibleUnits, len(input))
+	if err != nil {
+		return nil, err
+	}
+	return d.Forward(input), nil
 }
 
 // PreTraining performs Layer-wise greedy unsupervised training of RBMs.
-func (d *DBN) PreTraining(data [][]float64, option PreTrainingOption) {
-	newData := make([][]float64, len(data))
-	copy(newData, data)
+// Callbacks are invoked with the RBM of the layer being trained and receive
+// the index of the layer as "layer" in the metrics. Each layer is trained
+// with its own copy of option.Optimizer, starts with option.Schedule in its
+// initial state and writes its checkpoints to the file named by
+// LayerCheckpoint.
+func (d *DBN) PreTraining(data [][]float64, option PreTrainingOption) error {
+	return d.PreTrainingContext(context.Background(), data, option)
+}
+
+// PreTrainingContext is like PreTraining but stops at the next mini-batch
+// boundary when ctx is done and returns ctx.Err().
+func (d *DBN) PreTrainingContext(ctx context.Context, data [][]float64,
+	option PreTrainingOption) error {
+	return d.preTrain(ctx, data, option, false)
+}
+
+// ResumePreTraining continues pre-training from the checkpoints written by
+// PreTraining with option.Checkpoint. Layers are resumed from their
+// checkpoints as long as they exist, and the following layers are trained
+// from scratch, so d must be created as in the original run. data and
+// option must be the same as in the original run, except for options that
+// don't affect training such as Callbacks.
+func (d *DBN) ResumePreTraining(data [][]float64,
+	option PreTrainingOption) error {
+	return d.ResumePreTrainingContext(context.Background(), data, option)
+}
+
+// ResumePreTrainingContext is like ResumePreTraining but stops at the next
+// mini-batch boundary when ctx is done and returns ctx.Err().
+func (d *DBN) ResumePreTrainingContext(ctx context.Context, data [][]float64,
+	option PreTrainingOption) error {
+	if option.Checkpoint == "" {
+		return errors.New("dbn: no checkpoint to resume from")
+	}
+	return d.preTrain(ctx, data, option, true)
+}
+
+// LayerCheckpoint returns the name of the checkpoint file of a layer in
+// pre-training with the given checkpoint option, e.g. "dbn.layer0.json"
+// for "dbn.json".
+func LayerCheckpoint(checkpoint string, layer int) string {
+	if checkpoint == "" {
+		return ""
+	}
+	ext := filepath.Ext(checkpoint)
+	return fmt.Sprintf("%s.layer%d%s", checkpoint[:len(checkpoint)-len(ext)],
+		layer, ext)
+}
+
+// preTrain trains the layers in turn. If resume is set, layers are resumed
+// from their checkpoints up to the first layer without one.
+func (d *DBN) preTrain(ctx context.Context, data [][]float64,
+	option PreTrainingOption, resume bool) error {
+	if len(d.RBMs) == 0 {
+		return errNoLayers
+	}
+	newData := data
+	validationData := option.ValidationData
+
+	// Optimizers keep their state by the names of parameters, which are
+	// the same in all layers.
+	var optimizer []byte
+	if option.Optimizer != nil {
+		var err error
+		if optimizer, err = nnet.MarshalOptimizer(option.Optimizer); err != nil {
+			return err
+		}
+	}
+
+	// Schedules such as ReduceOnPlateau adapt to the layer being trained
+	// and are restored to the initial state for the next layer, as they are
+	// from checkpoints.
+	var schedule []byte
+	if option.Schedule != nil {
+		var err error
+		if schedule, err = json.Marshal(option.Schedule); err != nil {
+			return err
+		}
+	}
 
 	// layer-wise greedy training
+	var rng *rand.Rand // of the last resumed layer
 	for i := range d.RBMs {
-		option := rbm.TrainingOption{
-			LearningRate:         option.LearningRate,
-			Epoches:              option.Epoches,
-			OrderOfGibbsSampling: option.OrderOfGibbsSampling,
-			MiniBatchSize:        option.MiniBatchSize,
-			L2Regularization:     option.L2Regularization,
-			RegularizationRate:   option.RegularizationRate,
-			Monitoring:           option.Monitoring,
+		layerOption := option.TrainingOption
+		layerOption.Callbacks = make([]nnet.Callback, len(option.Callbacks))
+		for j, c := range option.Callbacks {
+			layerOption.Callbacks[j] = layerCallback{c, i}
+		}
+		layerOption.ValidationData = validationData
+		layerOption.Checkpoint = LayerCheckpoint(option.Checkpoint, i)
+		if optimizer != nil {
+			var err error
+			layerOption.Optimizer, err = nnet.UnmarshalOptimizer(optimizer)
+			if err != nil {
+				return err
+			}
+		}
+		if schedule != nil {
+			if err := json.Unmarshal(schedule, option.Schedule); err != nil {
+				return err
+			}
 		}
 
-		r := d.RBMs[i]
-		fmt.Printf("Start training %d layer.\n", i+1)
-		fmt.Println(r.NumVisibleUnits, r.NumHiddenUnits)
+		if resume {
+			_, err := os.Stat(layerOption.Checkpoint)
+			if os.IsNotExist(err) {
+				resume = false
+			} else if err != nil {
+				return err
+			}
+		}
 
 		// Train!
-		r.Train(newData, option)
+		r := d.RBMs[i]
+		var err error
+		if resume {
+			err = r.ResumeContext(ctx, layerOption.Checkpoint, newData,
+				layerOption)
+			rng = r.Rand()
+		} else {
+			// Continue the random numbers that the original run shared
+			// with the resumed layers
+			if rng != nil {
+				r.SetRand(rng)
+			}
+			err = r.TrainContext(ctx, newData, layerOption)
+		}
+		if err != nil {
+			return err
+		}
 
 		// Transfer activation to the next layer
-		for n := 0; n < len(newData); n++ {
-			newData[n] = r.Forward(newData[n])
+		newData = r.ForwardBatch(newData)
+		if validationData != nil {
+			validationData = r.ForwardBatch(validationData)
 		}
 	}
+	return nil
+}
+
+// layerCallback adds the index of the layer being pre-trained to metrics.
+type layerCallback struct {
+	nnet.Callback
+	layer int
+}
+
+func (c layerCallback) OnBatchEnd(model interface{}, epoch, batch int,
+	metrics nnet.Metrics) error {
+	return c.Callback.OnBatchEnd(model, epoch, batch, c.label(metrics))
+}
+
+func (c layerCallback) OnEpochEnd(model interface{}, epoch int,
+	metrics nnet.Metrics) error {
+	return c.Callback.OnEpochEnd(model, epoch, c.label(metrics))
+}
+
+func (c layerCallback) OnTrainEnd(model interface{},
+	metrics nnet.Metrics) error {
+	return c.Callback.OnTrainEnd(model, c.label(metrics))
+}
+
+func (c layerCallback) label(metrics nnet.Metrics) nnet.Metrics {
+	labeled := nnet.Metrics{"layer": float64(c.layer)}
+	for k, v := range metrics {
+		labeled[k] = v
+	}
+	return labeled
 }
 
 // FineTurning performs supervised training of Deep Neural Networks,
@@ -0,0 +1,189 @@
+package dbn
+
+import (
+	"context"
+	"fmt"
+	"github.com/r9y9/nnet"
+	"github.com/r9y9/nnet/rbm"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadBaselineDump(t *testing.T) {
+	// Written by Dump of the first version, with weights as arrays of rows
+	// and gradients of the RBMs.
+	d, err := Load(filepath.Join("testdata", "baseline.json"))
+	if err != nil {
+		t.Fatalf("Load returns %v, want nil.", err)
+	}
+	want := []float64{0.5066234170936695, 0.5060452651872344}
+	h := d.RBMs[1].Forward(d.RBMs[0].Forward([]float64{1, 0, 1}))
+	for i := range want {
+		if math.Abs(h[i]-want[i]) > 1.0e-12 {
+			t.Errorf("Forward returns %v at %d, want %v.", h[i], i, want[i])
+		}
+	}
+}
+
+func createDummyData(size int, rng *rand.Rand) [][]float64 {
+	data := make([][]float64, size)
+	for i := range data {
+		data[i] = make([]float64, 4)
+		for j := range data[i] {
+			if rng.Float64() < 0.3+0.4*float64(i%2) {
+				data[i][j] = 1
+			}
+		}
+	}
+	return data
+}
+
+func TestPreTrainingOptimizer(t *testing.T) {
+	d := New(nnet.NewRand(1))
+	d.AddLayer(4, 3)
+	d.AddLayer(3, 2)
+	option := PreTrainingOption{rbm.TrainingOption{
+		Epoches:              2,
+		OrderOfGibbsSampling: 1,
+		MiniBatchSize:        10,
+		Optimizer:            nnet.NewAdam(0.01),
+	}}
+	if err := d.PreTraining(createDummyData(50, nnet.NewRand(1)),
+		option); err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range d.RBMs {
+		adam, ok := r.Option.Optimizer.(*nnet.Adam)
+		if !ok || adam.Rate != 0.01 {
+			t.Errorf("Optimizer of layer %d is %v, want Adam with rate 0.01.",
+				i, r.Option.Optimizer)
+		} else if adam == option.Optimizer || len(adam.M) == 0 {
+			t.Errorf("Layer %d isn't trained with its own copy of Adam.", i)
+		}
+	}
+}
+
+// cancelAt cancels pre-training at the end of an epoch of a layer.
+type cancelAt struct {
+	nnet.BaseCallback
+	cancel       context.CancelFunc
+	layer, epoch int
+}
+
+func (c cancelAt) OnEpochEnd(model interface{}, epoch int,
+	metrics nnet.Metrics) error {
+	if int(metrics["layer"]) == c.layer && epoch == c.epoch {
+		c.cancel()
+	}
+	return nil
+}
+
+func TestResumePreTraining(t *testing.T) {
+	dir := t.TempDir()
+	data := createDummyData(50, nnet.NewRand(1))
+	newDBN := func(rng *rand.Rand) *DBN {
+		d := New(rng)
+		d.AddLayer(4, 3)
+		d.AddLayer(3, 2)
+		return d
+	}
+	newOption := func(checkpoint string) PreTrainingOption {
+		return PreTrainingOption{rbm.TrainingOption{
+			LearningRate:         0.1,
+			Epoches:              3,
+			OrderOfGibbsSampling: 1,
+			UsePersistent:        true,
+			MiniBatchSize:        10,
+			Shuffle:              true,
+			Optimizer:            nnet.NewMomentum(0.1, 0.5),
+			Checkpoint:           checkpoint,
+		}}
+	}
+
+	want := newDBN(nnet.NewRand(2))
+	full := filepath.Join(dir, "full.json")
+	if err := want.PreTraining(data, newOption(full)); err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range want.RBMs {
+		if !r.Option.UsePersistent {
+			t.Errorf("Layer %d is trained without persistent chains.", i)
+		}
+		if _, err := os.Stat(LayerCheckpoint(full, i)); err != nil {
+			t.Errorf("Checkpoint of layer %d: %v", i, err)
+		}
+	}
+
+	// Interrupted in each layer and resumed by a fresh DBN
+	for layer := range want.RBMs {
+		checkpoint := filepath.Join(dir, fmt.Sprintf("interrupted%d.json", layer))
+		ctx, cancel := context.WithCancel(context.Background())
+		option := newOption(checkpoint)
+		option.Callbacks = []nnet.Callback{cancelAt{cancel: cancel,
+			layer: layer, epoch: 1}}
+		err := newDBN(nnet.NewRand(2)).PreTrainingContext(ctx, data, option)
+		if err != context.Canceled {
+			t.Fatalf("PreTrainingContext returns %v, want context.Canceled.",
+				err)
+		}
+		d := newDBN(nnet.NewRand(2))
+		if err := d.ResumePreTraining(data, newOption(checkpoint)); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, r := range d.RBMs {
+			for j := range r.W.Data {
+				if r.W.Data[j] != want.RBMs[i].W.Data[j] {
+					t.Fatalf("Weights of layer %d resumed in layer %d are %v, want %v.",
+						i, layer, r.W.Data, want.RBMs[i].W.Data)
+				}
+			}
+		}
+	}
+}
+
+// learningRates records the learning rates of the mini-batches of each
+// layer.
+type learningRates struct {
+	nnet.BaseCallback
+	rates map[int][]float64
+}
+
+func (l learningRates) OnBatchEnd(model interface{}, epoch, batch int,
+	metrics nnet.Metrics) error {
+	layer := int(metrics["layer"])
+	l.rates[layer] = append(l.rates[layer], metrics["learning_rate"])
+	return nil
+}
+
+func TestPreTrainingSchedule(t *testing.T) {
+	d := New(nnet.NewRand(1))
+	d.AddLayer(4, 3)
+	d.AddLayer(3, 2)
+	l := learningRates{rates: map[int][]float64{}}
+	option := PreTrainingOption{rbm.TrainingOption{
+		LearningRate:         0.1,
+		Epoches:              3,
+		OrderOfGibbsSampling: 1,
+		MiniBatchSize:        50,
+		// Never improves, so that the rate is halved every epoch after
+		// the first
+		Schedule: &nnet.ReduceOnPlateau{Rate: 0.1, Factor: 0.5,
+			Threshold: 1.0e9, Maximize: true},
+		Callbacks: []nnet.Callback{l},
+	}}
+	if err := d.PreTraining(createDummyData(50, nnet.NewRand(1)),
+		option); err != nil {
+		t.Fatal(err)
+	}
+	for layer := range d.RBMs {
+		rates := l.rates[layer]
+		if len(rates) != 3 || rates[0] != 0.1 || rates[2] >= 0.1 {
+			t.Errorf("Learning rates of layer %d are %v, want to start at 0.1 and decrease.",
+				layer, rates)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/r9y9/nnet"
@@ -8,6 +9,7 @@ import (
 	"github.com/r9y9/nnet/mlp3"
 	"log"
 	"os"
+	"os/signal"
 	"time"
 )
 
@@ -85,17 +87,23 @@ func main() {
 	target := mnist.PrepareY(labels)
 
 	// Setup Neural Network
-	net := mlp3.NewNeuralNetwork(w*h, *numHiddenUnits, 10)
+	net := mlp3.NewNeuralNetwork(w*h, *numHiddenUnits, 10, nil, nil)
 	option := mlp3.TrainingOption{
 		LearningRate: *learningRate,
 		Epoches:      *epoches, // the number of iterations in SGD
 		Monitoring:   true,
 	}
 
+	// Ctrl-C stops training after the current iteration
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	// Perform training
 	start := time.Now()
-	nerr := net.Train(data, target, option)
-	if nerr != nil {
+	nerr := net.TrainContext(ctx, data, target, option)
+	if nerr == context.Canceled {
+		fmt.Println("Training interrupted.")
+	} else if nerr != nil {
 		log.Fatal(nerr)
 	}
 	elapsed := time.Now().Sub(start)
@@ -106,5 +114,7 @@ func main() {
 		log.Fatal(err)
 	}
 	fmt.Println("Parameters are dummped to", *outFilename)
-	fmt.Println("Training finished!")
+	if nerr == nil {
+		fmt.Println("Training finished!")
+	}
 }
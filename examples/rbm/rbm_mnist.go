@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"github.com/r9y9/nnet"
 	"github.com/r9y9/nnet/dataset/mnist"
 	"github.com/r9y9/nnet/rbm"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
 	"time"
 )
 
@@ -14,6 +18,7 @@ func main() {
 	outFilename := flag.String("output", "nn.json", "Output filename (*.json)")
 	modelFilename := flag.String("model", "", "Model filename (*.json)")
 	learningRate := flag.Float64("learning_rate", 0.1, "Learning rate")
+	decay := flag.Float64("decay", 1.0, "Decay of learning rate per epoch")
 	epoches := flag.Int("epoch", 5, "Epoches")
 	usePersistent := flag.Bool("persistent", false, "Persistent constrastive learning")
 	orderOfGibbsSampling := flag.Int("order", 1, "Order of Gibbs sampling")
@@ -21,6 +26,10 @@ func main() {
 	miniBatchSize := flag.Int("size", 20, "Mini-batch size")
 	l2 := flag.Bool("l2", false, "L2 regularization")
 	numHiddenUnits := flag.Int("hidden_units", 100, "Number of hidden units")
+	initBias := flag.Bool("init_bias", false, "Initialize visible biases from data")
+	checkpoint := flag.String("checkpoint", "", "Checkpoint filename written every epoch (*.json)")
+	resume := flag.Bool("resume", false, "Resume training from the checkpoint")
+	logFilename := flag.String("log", "", "Training log filename (*.csv or *.jsonl)")
 	flag.Parse()
 
 	trainingPath := "../data/train-images-idx3-ubyte"
@@ -48,7 +57,10 @@ func main() {
 		fmt.Println("Load parameters from", *modelFilename)
 	} else {
 		numVisibleUnits := w * h
-		r = rbm.New(numVisibleUnits, *numHiddenUnits)
+		r = rbm.New(numVisibleUnits, *numHiddenUnits, nil, nil)
+		if *initBias {
+			r.InitVisibleBias(data)
+		}
 	}
 
 	// Training
@@ -61,12 +73,43 @@ func main() {
 		L2Regularization:     *l2,
 		RegularizationRate:   0.0001,
 		Monitoring:           true,
+		Checkpoint:           *checkpoint,
+	}
+	if *decay != 1.0 {
+		option.Schedule = &nnet.ExponentialDecay{
+			Initial: *learningRate,
+			Decay:   *decay,
+		}
 	}
 
+	if *logFilename != "" {
+		logFile, err := os.Create(*logFilename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer logFile.Close()
+		format := nnet.CSV
+		if strings.HasSuffix(*logFilename, ".jsonl") {
+			format = nnet.JSONLines
+		}
+		option.Callbacks = []nnet.Callback{nnet.NewLogger(logFile, format)}
+	}
+
+	// Ctrl-C stops training after the current mini-batch
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	fmt.Println("Start training")
 	start := time.Now()
-	terr := r.Train(data, option)
-	if terr != nil {
+	var terr error
+	if *resume {
+		terr = r.ResumeContext(ctx, *checkpoint, data, option)
+	} else {
+		terr = r.TrainContext(ctx, data, option)
+	}
+	if terr == context.Canceled {
+		fmt.Println("Training interrupted.")
+	} else if terr != nil {
 		log.Fatal(terr)
 	}
 	fmt.Println("Elapsed:", time.Now().Sub(start))
@@ -76,5 +119,7 @@ func main() {
 		log.Fatal(oerr)
 	}
 	fmt.Println("Parameters are dumped to", *outFilename)
-	fmt.Println("Training finished.")
+	if terr == nil {
+		fmt.Println("Training finished.")
+	}
 }
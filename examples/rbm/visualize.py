@@ -18,7 +18,7 @@ f = open(filename)
 data = json.load(f)
 f.close()
  
-W = np.array(data['W'])
+W = np.array(data['W']['Data']).reshape(data['W']['Rows'], data['W']['Cols'])
 M = int(data['NumHiddenUnits'])
 w,h = int(np.sqrt(M)), int(np.sqrt(M))
 M = w*h
@@ -3,26 +3,32 @@
 package gbrbm
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/r9y9/nnet" // sigmoid, matrix
+	"github.com/r9y9/nnet/initializer"
 	"math"
 	"math/rand"
-	"os"
-	"time"
 )
 
 // Gaussian-Binary Restricted Boltzmann Machines (GBRBM)
 type GBRBM struct {
-	W                      [][]float64 // Weight
-	B                      []float64   // Bias of visible layer
-	C                      []float64   // Bias of hidden layer
+	W                      *nnet.Matrix // Weight
+	B                      []float64    // Bias of visible layer
+	C                      []float64    // Bias of hidden layer
 	NumHiddenUnits         int
 	NumVisibleUnits        int
-	PersistentVisibleUnits [][]float64 // used in Persistent contrastive learning
-	GradW                  [][]float64
-	GradB                  []float64
-	GradC                  []float64
+	PersistentVisibleUnits [][]float64  // used in Persistent contrastive learning
+	GradW                  *nnet.Matrix `json:"-"` // Gradient of W
+	GradB                  []float64    `json:"-"` // Gradient of B
+	GradC                  []float64    `json:"-"` // Gradient of C
 	Option                 TrainingOption
+	norms                  nnet.GradNorms // of the last update
+	defaultMomentum        bool
+	rng                    *rand.Rand
 }
 
 type TrainingOption struct {
@@ -32,36 +38,55 @@ type TrainingOption struct {
 	UseMean              bool // hack option
 	Epoches              int
 	MiniBatchSize        int
-	L2Regularization     bool
+	Shuffle              bool  // visits data in a different order every epoch
+	Seed                 int64 // seed of the order of shuffled data and of monitoring
+	DropRemainder        bool  // skips the last mini-batch if it is smaller
+	L2Regularization     bool  // Deprecated: use Regularization
 	RegularizationRate   float64
+	Regularization       *nnet.Regularization // of W, B and C; see nnet.Regularization
 	Monitoring           bool
+	NumWorkers           int             // goroutines that share a mini-batch
+	ClipNorm             float64         // maximum L2 norm of all gradients, 0 disables
+	ClipValue            float64         // maximum absolute value of gradients, 0 disables
+	Optimizer            nnet.Optimizer  `json:"-"`
+	Schedule             nnet.Schedule   `json:"-"`
+	Callbacks            []nnet.Callback `json:"-"`
+	ValidationData       [][]float64     `json:"-"`
+	ValidationMetric     nnet.Metric     `json:"-"` // reconstruction error if nil
+	Patience             int             // epochs without improvement before stopping
+	Checkpoint           string          // file to write checkpoints to, see Resume
+	CheckpointEvery      int             // epochs between checkpoints
 }
 
-// New creates new GBRBM instance.
-func New(numVisibleUnits, numHiddenUnits int) *GBRBM {
+// New creates new GBRBM instance. init initializes weights and rng is used
+// in initialization and training. Both may be nil; a nil rng is replaced by
+// a generator seeded by the current time.
+func New(numVisibleUnits, numHiddenUnits int,
+	init initializer.Initializer, rng *rand.Rand) *GBRBM {
 	rbm := new(GBRBM)
-	rand.Seed(time.Now().UnixNano())
+	rbm.rng = nnet.DefaultRand(rng)
 	rbm.NumVisibleUnits = numVisibleUnits
 	rbm.NumHiddenUnits = numHiddenUnits
-	rbm.W = nnet.MakeMatrix(numHiddenUnits, numVisibleUnits)
+	rbm.W = nnet.NewMatrix(numHiddenUnits, numVisibleUnits)
 	rbm.B = make([]float64, numVisibleUnits)
 	rbm.C = make([]float64, numHiddenUnits)
-	rbm.GradW = nnet.MakeMatrix(numHiddenUnits, numVisibleUnits)
+	rbm.GradW = nnet.NewMatrix(numHiddenUnits, numVisibleUnits)
 	rbm.GradB = make([]float64, numVisibleUnits)
 	rbm.GradC = make([]float64, numHiddenUnits)
-	rbm.InitParam()
+	rbm.InitParam(init)
 	return rbm
 }
 
-// InitParam performes a heuristic parameter initialization.
-func (rbm *GBRBM) InitParam() {
-	// Init W
-	for i := 0; i < rbm.NumHiddenUnits; i++ {
-		for j := 0; j < rbm.NumVisibleUnits; j++ {
-			rbm.W[i][j] = 0.01 * rand.NormFloat64()
-		}
+// InitParam initializes weights by init and biases to zero. If init is
+// nil, weights are drawn from N(0, 0.01^2).
+func (rbm *GBRBM) InitParam(init initializer.Initializer) {
+	if init == nil {
+		init = initializer.Normal{Mean: 0.0, Std: 0.01}
 	}
 
+	// Init W
+	init.Init(rbm.W, rbm.NumVisibleUnits, rbm.NumHiddenUnits, rbm.Rand())
+
 	// Init visible bias
 	for j := 0; j < rbm.NumVisibleUnits; j++ {
 		rbm.B[j] = 0.0
@@ -73,22 +98,26 @@ func (rbm *GBRBM) InitParam() {
 	}
 }
 
-// Load loads GBRBM from a dump file and return its instatnce.
-func Load(filename string) (*GBRBM, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+// Rand returns the random number generator of GBRBM. Models loaded from
+// dump files get a generator seeded by the current time.
+func (rbm *GBRBM) Rand() *rand.Rand {
+	if rbm.rng == nil {
+		rbm.rng = nnet.DefaultRand(nil)
 	}
-	defer file.Close()
+	return rbm.rng
+}
 
-	decoder := json.NewDecoder(file)
-	rbm := &GBRBM{}
-	err = decoder.Decode(rbm)
+// SetRand sets the random number generator used in training.
+func (rbm *GBRBM) SetRand(rng *rand.Rand) {
+	rbm.rng = rng
+}
 
-	if err != nil {
+// Load loads GBRBM from a dump file and return its instatnce.
+func Load(filename string) (*GBRBM, error) {
+	rbm := &GBRBM{}
+	if err := nnet.LoadFile(filename, rbm); err != nil {
 		return nil, err
 	}
-
 	return rbm, nil
 }
 
@@ -98,29 +127,106 @@ func (rbm *GBRBM) Dump(filename string) error {
 	return nnet.DumpAsJson(filename, rbm)
 }
 
+// UnmarshalJSON implements json.Unmarshaler. Unknown fields are rejected,
+// except for the gradients that dumps of earlier versions contain.
+func (rbm *GBRBM) UnmarshalJSON(b []byte) error {
+	type model GBRBM
+	aux := struct {
+		*model
+		GradW, GradB, GradC json.RawMessage // ignored
+	}{model: (*model)(rbm)}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(&aux)
+}
+
+func init() {
+	nnet.RegisterModel("gbrbm", func() nnet.Model { return &GBRBM{} })
+}
+
+// Kind implements nnet.Model.
+func (rbm *GBRBM) Kind() string {
+	return "gbrbm"
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. Only the parameters are
+// encoded; training options and persistent chains are not.
+func (rbm *GBRBM) MarshalBinary() ([]byte, error) {
+	var e nnet.BinaryEncoder
+	e.Matrix(rbm.W)
+	e.Float64s(rbm.B)
+	e.Float64s(rbm.C)
+	return e.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (rbm *GBRBM) UnmarshalBinary(b []byte) error {
+	d := nnet.NewBinaryDecoder(b)
+	W, B, C := d.Matrix(), d.Float64s(), d.Float64s()
+	if err := d.Finish(); err != nil {
+		return err
+	}
+	if len(B) != W.Cols || len(C) != W.Rows {
+		return fmt.Errorf("gbrbm: bias lengths %d and %d don't match weight %dx%d",
+			len(B), len(C), W.Rows, W.Cols)
+	}
+	rbm.W, rbm.B, rbm.C = W, B, C
+	rbm.NumHiddenUnits, rbm.NumVisibleUnits = W.Rows, W.Cols
+	return nil
+}
+
 // Forward performs activity propagation from visible to hidden layer.
 func (rbm *GBRBM) Forward(v []float64) []float64 {
-	hidden := make([]float64, rbm.NumHiddenUnits)
-	for i := 0; i < rbm.NumHiddenUnits; i++ {
-		hidden[i] = rbm.P_H_Given_V(i, v)
+	hidden := rbm.W.MulVec(v, nil)
+	for i := range hidden {
+		hidden[i] = nnet.Sigmoid(hidden[i] + rbm.C[i])
 	}
 	return hidden
 }
 
+// ForwardBatch performs Forward for all inputs concurrently.
+func (rbm *GBRBM) ForwardBatch(v [][]float64) [][]float64 {
+	return nnet.ForwardBatch(rbm, v)
+}
+
+// Validate implements nnet.Validator. It checks that the weight and the
+// biases match the numbers of units.
+func (rbm *GBRBM) Validate() error {
+	if rbm.W == nil {
+		return errors.New("gbrbm: no weight")
+	}
+	if err := nnet.CheckSize("weight rows", rbm.NumHiddenUnits,
+		rbm.W.Rows); err != nil {
+		return err
+	}
+	if err := nnet.CheckSize("weight columns", rbm.NumVisibleUnits,
+		rbm.W.Cols); err != nil {
+		return err
+	}
+	if err := nnet.CheckSize("visible bias", rbm.NumVisibleUnits,
+		len(rbm.B)); err != nil {
+		return err
+	}
+	return nnet.CheckSize("hidden bias", rbm.NumHiddenUnits, len(rbm.C))
+}
+
+// ValidateShape implements nnet.ShapeValidator. target is ignored.
+func (rbm *GBRBM) ValidateShape(input, target [][]float64) error {
+	return nnet.CheckRows("input", input, rbm.NumVisibleUnits)
+}
+
 // P_H_Given_V returns p(h=1|v), the conditinal probability of activation
 // of a hidden unit given a set of visible units.
 func (rbm *GBRBM) P_H_Given_V(hiddenIndex int, v []float64) float64 {
-	sum := 0.0
-	for j := 0; j < rbm.NumVisibleUnits; j++ {
-		sum += rbm.W[hiddenIndex][j] * v[j]
-	}
+	sum := nnet.Dot(rbm.W.Row(hiddenIndex), v)
 	return nnet.Sigmoid(sum + rbm.C[hiddenIndex])
 }
 
 // Sample_H_Given_V returns sample drawen by p(h|v), where h is a binary unit.
-func (rbm *GBRBM) Sample_H_Given_V(hiddenIndex int, v []float64) float64 {
+func (rbm *GBRBM) Sample_H_Given_V(hiddenIndex int, v []float64,
+	rng *rand.Rand) float64 {
 	p := rbm.P_H_Given_V(hiddenIndex, v)
-	if p > rand.Float64() {
+	if p > rng.Float64() {
 		return 1.0
 	} else {
 		return 0.0
@@ -131,19 +237,21 @@ func (rbm *GBRBM) Sample_H_Given_V(hiddenIndex int, v []float64) float64 {
 func (rbm *GBRBM) Mean_V_Given_H(visibleIndex int, h []float64) float64 {
 	sum := 0.0
 	for i := 0; i < rbm.NumHiddenUnits; i++ {
-		sum += rbm.W[i][visibleIndex] * h[i]
+		sum += rbm.W.At(i, visibleIndex) * h[i]
 	}
 	return sum + rbm.B[visibleIndex]
 }
 
 // Sample_V_Given_H returns a sample generated by Gaussian distribution p(v|h).
-func (rbm *GBRBM) Sample_V_Given_H(visibleIndex int, h []float64) float64 {
-	return rbm.Mean_V_Given_H(visibleIndex, h) + rand.NormFloat64()*1.0
+func (rbm *GBRBM) Sample_V_Given_H(visibleIndex int, h []float64,
+	rng *rand.Rand) float64 {
+	return rbm.Mean_V_Given_H(visibleIndex, h) + rng.NormFloat64()*1.0
 }
 
 // Reconstruct performs reconstruction based on k-Gibbs sampling algorithm,
-// where k is the number of iterations.
-func (rbm *GBRBM) Reconstruct(v []float64, numSteps int, useMean bool) []float64 {
+// where k is the number of iterations. rng is used to draw samples.
+func (rbm *GBRBM) Reconstruct(v []float64, numSteps int, useMean bool,
+	rng *rand.Rand) []float64 {
 	// Initial value is set to input
 	reconstructedVisible := make([]float64, len(v))
 	copy(reconstructedVisible, v)
@@ -154,7 +262,7 @@ func (rbm *GBRBM) Reconstruct(v []float64, numSteps int, useMean bool) []float64
 		hiddenState := make([]float64, rbm.NumHiddenUnits)
 		for i := 0; i < rbm.NumHiddenUnits; i++ {
 			hiddenState[i] =
-				rbm.Sample_H_Given_V(i, reconstructedVisible)
+				rbm.Sample_H_Given_V(i, reconstructedVisible, rng)
 		}
 		// 2. sample visible units
 		// try to use the mean value instread if training is unstable
@@ -164,7 +272,7 @@ func (rbm *GBRBM) Reconstruct(v []float64, numSteps int, useMean bool) []float64
 					rbm.Mean_V_Given_H(j, hiddenState)
 			} else {
 				reconstructedVisible[j] =
-					rbm.Sample_V_Given_H(j, hiddenState)
+					rbm.Sample_V_Given_H(j, hiddenState, rng)
 			}
 		}
 	}
@@ -174,10 +282,11 @@ func (rbm *GBRBM) Reconstruct(v []float64, numSteps int, useMean bool) []float64
 
 // ReconstructionError returns reconstruction error.
 // Use mean of Gaussian when computing reconstruction error.
-func (rbm *GBRBM) ReconstructionError(data [][]float64, numSteps int) float64 {
+func (rbm *GBRBM) ReconstructionError(data [][]float64, numSteps int,
+	rng *rand.Rand) float64 {
 	err := 0.0
 	for _, v := range data {
-		reconstructed := rbm.Reconstruct(v, numSteps, true)
+		reconstructed := rbm.Reconstruct(v, numSteps, true, rng)
 		err += nnet.SquareErrBetweenTwoVector(v, reconstructed)
 	}
 	return 0.5 * err / float64(len(data))
@@ -193,23 +302,25 @@ func (rbm *GBRBM) FreeEnergy(v []float64) float64 {
 	}
 
 	for i := 0; i < rbm.NumHiddenUnits; i++ {
-		sum := rbm.C[i]
-		for j := 0; j < rbm.NumVisibleUnits; j++ {
-			sum += rbm.W[i][j] * v[j]
-		}
+		sum := rbm.C[i] + nnet.Dot(rbm.W.Row(i), v)
 		energy -= math.Log(1 + math.Exp(sum))
 	}
 
 	return energy
 }
 
+// UnSupervisedObjective returns the reconstruction error of a random
+// subset of data. It draws from a generator seeded by Option.Seed rather
+// than from Rand, so that monitoring doesn't change training.
 func (rbm *GBRBM) UnSupervisedObjective(data [][]float64) float64 {
 	size := 3000
 	if size > len(data) {
 		size = len(data)
 	}
-	subset := nnet.RandomSubset(data, size)
-	return rbm.ReconstructionError(subset, rbm.Option.OrderOfGibbsSampling)
+	rng := nnet.NewRand(rbm.Option.Seed)
+	subset := nnet.RandomSubsetRand(data, size, rng)
+	return rbm.ReconstructionError(subset, rbm.Option.OrderOfGibbsSampling,
+		rng)
 }
 
 func (rbm *GBRBM) P_H_Given_V_Batch(v []float64) []float64 {
@@ -221,16 +332,57 @@ func (rbm *GBRBM) P_H_Given_V_Batch(v []float64) []float64 {
 }
 
 // Gradient returns gradients of GBRBM parameters for a given (mini-batch) dataset.
+// The mini-batch is split across Option.NumWorkers goroutines and the
+// partial gradients are summed in a fixed order, so that the result is
+// reproducible for a given number of workers.
 func (rbm *GBRBM) Gradient(data [][]float64,
-	miniBatchIndex int) ([][]float64, []float64, []float64) {
-	gradW := nnet.MakeMatrix(rbm.NumHiddenUnits, rbm.NumVisibleUnits)
+	miniBatchIndex int) (*nnet.Matrix, []float64, []float64) {
+	numChunks := nnet.NumChunks(len(data), rbm.Option.NumWorkers)
+	gradWs := make([]*nnet.Matrix, numChunks)
+	gradBs := make([][]float64, numChunks)
+	gradCs := make([][]float64, numChunks)
+
+	// Each worker samples with its own generator seeded from rbm.Rand()
+	rngs := make([]*rand.Rand, numChunks)
+	if numChunks == 1 {
+		rngs[0] = rbm.Rand()
+	} else {
+		for c := range rngs {
+			rngs[c] = nnet.NewRand(rbm.Rand().Int63())
+		}
+	}
+
+	// Persistent chains belong to positions in the epoch rather than to
+	// samples, so that each chain is continued once per epoch even if the
+	// data is shuffled. Only the last mini-batch can be smaller.
+	offset := miniBatchIndex * rbm.Option.MiniBatchSize
+	nnet.ParallelFor(len(data), rbm.Option.NumWorkers, func(c, b, e int) {
+		gradWs[c], gradBs[c], gradCs[c] =
+			rbm.gradientSum(data[b:e], offset+b, rngs[c])
+	})
+
+	gradW, gradB, gradC := gradWs[0], gradBs[0], gradCs[0]
+	for c := 1; c < numChunks; c++ {
+		gradW.AddScaled(1.0, gradWs[c])
+		nnet.Axpy(1.0, gradBs[c], gradB)
+		nnet.Axpy(1.0, gradCs[c], gradC)
+	}
+
+	return rbm.normalizeGradBySizeOfBatch(gradW, gradB, gradC, len(data))
+}
+
+// gradientSum returns the sum of gradients over data. persistentOffset is
+// the index of the persistent chain of data[0].
+func (rbm *GBRBM) gradientSum(data [][]float64, persistentOffset int,
+	rng *rand.Rand) (*nnet.Matrix, []float64, []float64) {
+	gradW := nnet.NewMatrix(rbm.NumHiddenUnits, rbm.NumVisibleUnits)
 	gradB := make([]float64, rbm.NumVisibleUnits)
 	gradC := make([]float64, rbm.NumHiddenUnits)
 
 	for i, v := range data {
 		// Set start state of Gibbs-sampling
 		var gibbsStart []float64
-		persistentIndex := i + miniBatchIndex*rbm.Option.MiniBatchSize
+		persistentIndex := i + persistentOffset
 		if rbm.Option.UsePersistent {
 			gibbsStart = rbm.PersistentVisibleUnits[persistentIndex]
 		} else {
@@ -239,7 +391,7 @@ func (rbm *GBRBM) Gradient(data [][]float64,
 
 		// Perform reconstruction using Gibbs-sampling
 		reconstructedVisible := rbm.Reconstruct(gibbsStart,
-			rbm.Option.OrderOfGibbsSampling, rbm.Option.UseMean)
+			rbm.Option.OrderOfGibbsSampling, rbm.Option.UseMean, rng)
 
 		// keep recostructed visible
 		if rbm.Option.UsePersistent {
@@ -252,12 +404,8 @@ func (rbm *GBRBM) Gradient(data [][]float64,
 		p_h_given_v2 := rbm.P_H_Given_V_Batch(reconstructedVisible)
 
 		// Gompute gradient of W
-		for i := 0; i < rbm.NumHiddenUnits; i++ {
-			for j := 0; j < rbm.NumVisibleUnits; j++ {
-				gradW[i][j] += p_h_given_v1[i]*v[j] -
-					p_h_given_v2[i]*reconstructedVisible[j]
-			}
-		}
+		gradW.AddOuter(1.0, p_h_given_v1, v)
+		gradW.AddOuter(-1.0, p_h_given_v2, reconstructedVisible)
 
 		// Gompute gradient of B
 		for j := 0; j < rbm.NumVisibleUnits; j++ {
@@ -270,16 +418,12 @@ func (rbm *GBRBM) Gradient(data [][]float64,
 		}
 	}
 
-	return rbm.normalizeGradBySizeOfBatch(gradW, gradB, gradC, len(data))
+	return gradW, gradB, gradC
 }
 
-func (rbm *GBRBM) normalizeGradBySizeOfBatch(gradW [][]float64,
-	gradB, gradC []float64, size int) ([][]float64, []float64, []float64) {
-	for i := 0; i < rbm.NumHiddenUnits; i++ {
-		for j := 0; j < rbm.NumVisibleUnits; j++ {
-			gradW[i][j] /= float64(size)
-		}
-	}
+func (rbm *GBRBM) normalizeGradBySizeOfBatch(gradW *nnet.Matrix,
+	gradB, gradC []float64, size int) (*nnet.Matrix, []float64, []float64) {
+	gradW.Scale(1.0 / float64(size))
 	for j := 0; j < rbm.NumVisibleUnits; j++ {
 		gradB[j] /= float64(size)
 	}
@@ -293,55 +437,208 @@ func (rbm *GBRBM) UnSupervisedMiniBatchUpdate(batch [][]float64,
 	epoch, miniBatchIndex int) {
 	gradW, gradB, gradC := rbm.Gradient(batch, miniBatchIndex)
 
-	// TODO fix
-	momentum := 0.5
-	if epoch > 5 {
-		momentum = 0.7
+	// Gradient returns the direction to increase the log-likelihood,
+	// whereas optimizers minimize the objective.
+	gradW.Scale(-1.0)
+	for j := range gradB {
+		gradB[j] = -gradB[j]
+	}
+	for i := range gradC {
+		gradC[i] = -gradC[i]
 	}
+	rbm.GradW, rbm.GradB, rbm.GradC = gradW, gradB, gradC
 
-	// Update W
-	for i := 0; i < rbm.NumHiddenUnits; i++ {
-		for j := 0; j < rbm.NumVisibleUnits; j++ {
-			grad := momentum*rbm.GradW[i][j] + rbm.Option.LearningRate*gradW[i][j]
-			rbm.W[i][j] += grad
-			if rbm.Option.L2Regularization {
-				rbm.W[i][j] *= (1.0 - rbm.Option.RegularizationRate)
-			}
-			rbm.GradW[i][j] = grad
-		}
+	optimizer := rbm.optimizer()
+	if m, ok := optimizer.(*nnet.Momentum); ok && rbm.defaultMomentum &&
+		epoch > 5 {
+		m.Momentum = 0.7
 	}
 
-	// Update B
-	for j := 0; j < rbm.NumVisibleUnits; j++ {
-		grad := momentum*rbm.GradB[j] + rbm.Option.LearningRate*gradB[j]
-		rbm.B[j] += grad
-		rbm.GradB[j] = grad
+	params := rbm.Params()
+	rbm.norms.Clip(params, rbm.Option.ClipNorm, rbm.Option.ClipValue)
+	rbm.Option.Regularization.AddGradients(params)
+	for _, p := range params {
+		optimizer.Update(p)
 	}
+	rbm.Option.Regularization.Constrain(params, optimizer.LearningRate())
 
-	// Update C
-	for i := 0; i < rbm.NumHiddenUnits; i++ {
-		grad := momentum*rbm.GradC[i] + rbm.Option.LearningRate*gradC[i]
-		rbm.C[i] += grad
-		rbm.GradC[i] = grad
+	// Shrinks W regardless of the learning rate
+	if rbm.Option.L2Regularization {
+		rbm.W.Scale(1.0 - rbm.Option.RegularizationRate)
+	}
+}
+
+// Params returns the parameters of GBRBM together with their gradients
+// computed by the last mini-batch update.
+func (rbm *GBRBM) Params() []*nnet.Param {
+	if rbm.GradW == nil {
+		rbm.GradW = nnet.NewMatrix(rbm.W.Dims())
+		rbm.GradB = make([]float64, len(rbm.B))
+		rbm.GradC = make([]float64, len(rbm.C))
+	}
+	return []*nnet.Param{
+		{Name: "W", Value: rbm.W.Data, Grad: rbm.GradW.Data,
+			Rows: rbm.W.Rows, Cols: rbm.W.Cols, UnitsInRows: true},
+		{Name: "B", Value: rbm.B, Grad: rbm.GradB},
+		{Name: "C", Value: rbm.C, Grad: rbm.GradC},
+	}
+}
+
+// GradNorms returns the norms of the gradients of the last update before
+// clipping, see nnet.GradNorms.
+func (rbm *GBRBM) GradNorms() nnet.Metrics {
+	return rbm.norms.Metrics()
+}
+
+// LearningRate returns the learning rate of the optimizer.
+func (rbm *GBRBM) LearningRate() float64 {
+	return rbm.optimizer().LearningRate()
+}
+
+// SetLearningRate sets the learning rate of the optimizer.
+func (rbm *GBRBM) SetLearningRate(rate float64) {
+	rbm.optimizer().SetLearningRate(rate)
+}
+
+// optimizer returns the optimizer used in training. It defaults to
+// momentum of 0.5, which is raised to 0.7 after five epochs. Optimizers
+// given by options are used as they are.
+func (rbm *GBRBM) optimizer() nnet.Optimizer {
+	if rbm.Option.Optimizer == nil {
+		rbm.Option.Optimizer = nnet.NewMomentum(rbm.Option.LearningRate, 0.5)
+		rbm.defaultMomentum = true
 	}
+	return rbm.Option.Optimizer
 }
 
 // Train performs Contrastive divergense learning algorithm to train GBRBM.
 // The alrogithm is based on (mini-batch) Stochastic Gradient Ascent.
 func (rbm *GBRBM) Train(data [][]float64, option TrainingOption) error {
+	return rbm.TrainContext(context.Background(), data, option)
+}
+
+// TrainContext is like Train but stops at the next mini-batch boundary when
+// ctx is done and returns ctx.Err(). The model is left as it was after the
+// last mini-batch update.
+func (rbm *GBRBM) TrainContext(ctx context.Context, data [][]float64,
+	option TrainingOption) error {
+	rbm.setOption(option)
+
+	// Peistent Contrastive learning
+	if rbm.Option.UsePersistent && len(data) > 0 {
+		rbm.PersistentVisibleUnits = nnet.MakeMatrix(len(data), len(data[0]))
+		copy(rbm.PersistentVisibleUnits, data)
+	}
+
+	return rbm.trainer().UnSupervisedMiniBatchTrainContext(ctx, rbm, data)
+}
+
+// TrainDataset is like Train but reads mini-batches from data, which need
+// not fit in memory. Persistent contrastive learning is not supported since
+// it keeps a chain for every sample.
+func (rbm *GBRBM) TrainDataset(data nnet.Dataset, option TrainingOption) error {
+	return rbm.TrainDatasetContext(context.Background(), data, option)
+}
+
+// TrainDatasetContext is like TrainDataset but stops at the next mini-batch
+// boundary when ctx is done and returns ctx.Err().
+func (rbm *GBRBM) TrainDatasetContext(ctx context.Context, data nnet.Dataset,
+	option TrainingOption) error {
+	if option.UsePersistent {
+		return errors.New("Persistent contrastive learning needs in-memory data.")
+	}
+	rbm.setOption(option)
+	return rbm.trainer().UnSupervisedMiniBatchTrainDatasetContext(ctx, rbm,
+		data)
+}
+
+// Resume continues training from a checkpoint written by Train with
+// option.Checkpoint. data and option must be the same as in the original
+// run, except for options that don't affect training such as Callbacks and
+// Epoches.
+func (rbm *GBRBM) Resume(filename string, data [][]float64,
+	option TrainingOption) error {
+	return rbm.ResumeContext(context.Background(), filename, data, option)
+}
+
+// ResumeContext is like Resume but stops at the next mini-batch boundary
+// when ctx is done and returns ctx.Err().
+func (rbm *GBRBM) ResumeContext(ctx context.Context, filename string,
+	data [][]float64, option TrainingOption) error {
+	rbm.setOption(option)
+	s := rbm.trainer()
+	if err := s.Resume(filename, rbm); err != nil {
+		return err
+	}
+	return s.UnSupervisedMiniBatchTrainContext(ctx, rbm, data)
+}
+
+// setOption sets the options of a training run. The default optimizer of a
+// previous run is dropped with them.
+func (rbm *GBRBM) setOption(option TrainingOption) {
 	rbm.Option = option
+	rbm.defaultMomentum = false
+}
+
+// trainer returns a trainer for the current options.
+func (rbm *GBRBM) trainer() *nnet.Trainer {
 	opt := nnet.BaseTrainingOption{
 		Epoches:       rbm.Option.Epoches,
 		MiniBatchSize: rbm.Option.MiniBatchSize,
+		Shuffle:       rbm.Option.Shuffle,
+		Seed:          rbm.Option.Seed,
+		DropRemainder: rbm.Option.DropRemainder,
 		Monitoring:    rbm.Option.Monitoring,
+		Schedule:      rbm.Option.Schedule,
+		Callbacks:     rbm.Option.Callbacks,
+
+		ValidationInput:  rbm.Option.ValidationData,
+		ValidationMetric: rbm.Option.ValidationMetric,
+		Patience:         rbm.Option.Patience,
+
+		Checkpoint:      rbm.Option.Checkpoint,
+		CheckpointEvery: rbm.Option.CheckpointEvery,
 	}
+	return nnet.NewTrainer(opt)
+}
 
-	// Peistent Contrastive learning
-	if rbm.Option.UsePersistent {
-		rbm.PersistentVisibleUnits = nnet.MakeMatrix(len(data), len(data[0]))
-		copy(rbm.PersistentVisibleUnits, data)
+// checkpoint is the training state of GBRBM.
+type checkpoint struct {
+	GBRBM           *GBRBM
+	Optimizer       json.RawMessage
+	Seed            int64
+	DefaultMomentum bool
+}
+
+// Checkpoint implements nnet.Checkpointer.
+func (rbm *GBRBM) Checkpoint() ([]byte, error) {
+	optimizer, err := nnet.MarshalOptimizer(rbm.optimizer())
+	if err != nil {
+		return nil, err
 	}
+	return json.Marshal(checkpoint{
+		GBRBM:           rbm,
+		Optimizer:       optimizer,
+		Seed:            nnet.ReseedRand(rbm.Rand()),
+		DefaultMomentum: rbm.defaultMomentum,
+	})
+}
 
-	s := nnet.NewTrainer(opt)
-	return s.UnSupervisedMiniBatchTrain(rbm, data)
+// RestoreCheckpoint implements nnet.Checkpointer. The optimizer is restored
+// from the checkpoint, while the other options are kept.
+func (rbm *GBRBM) RestoreCheckpoint(b []byte) error {
+	option := rbm.Option
+	c := checkpoint{GBRBM: rbm}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return err
+	}
+	optimizer, err := nnet.UnmarshalOptimizer(c.Optimizer)
+	if err != nil {
+		return err
+	}
+	option.Optimizer = optimizer
+	rbm.Option = option
+	rbm.rng = nnet.NewRand(c.Seed)
+	rbm.defaultMomentum = c.DefaultMomentum
+	return nil
 }
@@ -0,0 +1,95 @@
+package gbrbm
+
+import (
+	"github.com/r9y9/nnet"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func createDummyData(size int, rng *rand.Rand) [][]float64 {
+	data := make([][]float64, size)
+	for i := range data {
+		mean := 0.0
+		if i >= size/2 {
+			mean = 1.0
+		}
+		data[i] = []float64{rng.NormFloat64()*0.1 + mean,
+			rng.NormFloat64()*0.1 + mean}
+	}
+	return data
+}
+
+func TestGBRBMOptimizerAfterDefaultMomentum(t *testing.T) {
+	data := createDummyData(100, nnet.NewRand(1))
+	r := New(2, 2, nil, nnet.NewRand(1))
+	option := TrainingOption{
+		LearningRate:         0.01,
+		Epoches:              7,
+		OrderOfGibbsSampling: 1,
+		MiniBatchSize:        20,
+	}
+	if err := r.Train(data, option); err != nil {
+		t.Fatalf("Train returns %v, want nil.", err)
+	}
+	if m := r.Option.Optimizer.(*nnet.Momentum).Momentum; m != 0.7 {
+		t.Errorf("Default momentum after training is %v, want 0.7.", m)
+	}
+
+	// Optimizers given by options must be left as they are.
+	option.Optimizer = nnet.NewAdam(0.01)
+	if err := r.Train(data, option); err != nil {
+		t.Fatalf("Train returns %v, want nil.", err)
+	}
+	momentum := nnet.NewMomentum(0.01, 0.9)
+	option.Optimizer = momentum
+	if err := r.Train(data, option); err != nil {
+		t.Fatalf("Train returns %v, want nil.", err)
+	}
+	if momentum.Momentum != 0.9 {
+		t.Errorf("Momentum after training is %v, want 0.9.", momentum.Momentum)
+	}
+}
+
+func TestGBRBMCallbacksDontChangeTraining(t *testing.T) {
+	option := TrainingOption{
+		LearningRate:         0.01,
+		Epoches:              5,
+		OrderOfGibbsSampling: 1,
+		MiniBatchSize:        20,
+	}
+	var models [2]*GBRBM
+	for i := range models {
+		if i == 1 {
+			option.Callbacks = []nnet.Callback{nnet.BaseCallback{}}
+		}
+		data := createDummyData(100, nnet.NewRand(1))
+		models[i] = New(2, 3, nil, nnet.NewRand(2))
+		if err := models[i].Train(data, option); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := range models[0].W.Data {
+		if models[0].W.Data[i] != models[1].W.Data[i] {
+			t.Fatalf("Weights differ with a callback: %v and %v.",
+				models[0].W.Data, models[1].W.Data)
+		}
+	}
+}
+
+func TestLoadBaselineDump(t *testing.T) {
+	// Written by Dump of the first version, with weights as arrays of rows
+	// and gradients.
+	r, err := Load(filepath.Join("testdata", "baseline.json"))
+	if err != nil {
+		t.Fatalf("Load returns %v, want nil.", err)
+	}
+	want := []float64{0.512391613411224, 0.5134878477207577}
+	for i, h := range r.Forward([]float64{1, 0, 1}) {
+		if math.Abs(h-want[i]) > 1.0e-12 {
+			t.Errorf("Forward returns %v at %d, want %v.", h, i, want[i])
+		}
+	}
+}
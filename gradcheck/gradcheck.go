@@ -0,0 +1,86 @@
+// Package gradcheck verifies analytic gradients of models against finite
+// differences of their objective.
+package gradcheck
+
+import (
+	"fmt"
+	"github.com/r9y9/nnet"
+	"math"
+)
+
+// DefaultEpsilon is the perturbation used if Check is given zero.
+const DefaultEpsilon = 1.0e-5
+
+// Model is a supervised model whose gradients can be checked. Params must
+// return views of the parameters so that perturbing Value changes the
+// model. ComputeGradient stores the gradients of SupervisedObjective in
+// Grad of Params without updating the parameters.
+type Model interface {
+	nnet.Parameterized
+	nnet.SupervisedObjectiver
+	ComputeGradient(input, target [][]float64)
+}
+
+// Result is the outcome of the check of one parameter.
+type Result struct {
+	Name string
+
+	// RelativeError is the largest |a - n| / max(|a| + |n|, epsilon) over
+	// all elements, where a is the analytic and n the numerical gradient.
+	RelativeError float64
+
+	// Index is the element with the largest error.
+	Index int
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%s: relative error %g at %d", r.Name,
+		r.RelativeError, r.Index)
+}
+
+// Check compares the gradients computed by m for the data with central
+// differences (f(x + epsilon) - f(x - epsilon)) / (2 * epsilon) of the
+// objective and returns a result for each parameter, in the order of
+// Params. Parameters are restored after perturbation.
+func Check(m Model, input, target [][]float64, epsilon float64) []Result {
+	if epsilon <= 0 {
+		epsilon = DefaultEpsilon
+	}
+
+	// Gradients may be reallocated by later calls, so keep a copy.
+	m.ComputeGradient(input, target)
+	params := m.Params()
+	analytic := make([][]float64, len(params))
+	for i, p := range params {
+		analytic[i] = append([]float64(nil), p.Grad...)
+	}
+
+	results := make([]Result, len(params))
+	for i, p := range params {
+		results[i].Name = p.Name
+		for j, x := range p.Value {
+			p.Value[j] = x + epsilon
+			plus := m.SupervisedObjective(input, target)
+			p.Value[j] = x - epsilon
+			minus := m.SupervisedObjective(input, target)
+			p.Value[j] = x
+
+			a := analytic[i][j]
+			n := (plus - minus) / (2 * epsilon)
+			e := math.Abs(a-n) / math.Max(math.Abs(a)+math.Abs(n), epsilon)
+			if e > results[i].RelativeError {
+				results[i].RelativeError, results[i].Index = e, j
+			}
+		}
+	}
+	return results
+}
+
+// MaxError returns the largest relative error of results.
+func MaxError(results []Result) float64 {
+	max := 0.0
+	for _, r := range results {
+		max = math.Max(max, r.RelativeError)
+	}
+	return max
+}
@@ -0,0 +1,55 @@
+package gradcheck
+
+import (
+	"github.com/r9y9/nnet"
+	"testing"
+)
+
+// quadratic has the objective sum_i 0.5 * a_i * x_i^2 averaged over no data.
+// If wrong is true, its gradient of x_1 is off by a factor of two.
+type quadratic struct {
+	a, x, grad []float64
+	wrong      bool
+}
+
+func (q *quadratic) Params() []*nnet.Param {
+	return []*nnet.Param{{Name: "x", Value: q.x, Grad: q.grad}}
+}
+
+func (q *quadratic) SupervisedObjective(input, target [][]float64) float64 {
+	sum := 0.0
+	for i := range q.x {
+		sum += 0.5 * q.a[i] * q.x[i] * q.x[i]
+	}
+	return sum
+}
+
+func (q *quadratic) ComputeGradient(input, target [][]float64) {
+	for i := range q.x {
+		q.grad[i] = q.a[i] * q.x[i]
+	}
+	if q.wrong {
+		q.grad[1] *= 2
+	}
+}
+
+func TestCheck(t *testing.T) {
+	q := &quadratic{a: []float64{1, 2, 3}, x: []float64{0.5, -1, 2},
+		grad: make([]float64, 3)}
+	results := Check(q, nil, nil, 0)
+	if len(results) != 1 || results[0].Name != "x" {
+		t.Fatalf("Check returns %v, want a result of x.", results)
+	}
+	if e := MaxError(results); e > 1.0e-7 {
+		t.Errorf("Relative error of a correct gradient is %v, want < 1e-7.", e)
+	}
+	if q.x[0] != 0.5 || q.x[1] != -1 || q.x[2] != 2 {
+		t.Errorf("Parameters are %v after Check, want [0.5 -1 2].", q.x)
+	}
+
+	q.wrong = true
+	results = Check(q, nil, nil, 0)
+	if results[0].Index != 1 || results[0].RelativeError < 0.1 {
+		t.Errorf("Check of a wrong gradient returns %v.", results[0])
+	}
+}
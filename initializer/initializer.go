@@ -0,0 +1,176 @@
+// Package initializer provides weight initialization strategies for neural
+// networks. It is imported as "github.com/r9y9/nnet/initializer".
+package initializer
+
+import (
+	"github.com/r9y9/nnet"
+	"math"
+	"math/rand"
+)
+
+// References:
+// [1] X. Glorot and Y. Bengio, "Understanding the difficulty of training
+// deep feedforward neural networks", AISTATS 2010.
+//
+// [2] K. He et al., "Delving Deep into Rectifiers: Surpassing Human-Level
+// Performance on ImageNet Classification", ICCV 2015.
+//
+// [3] Y. LeCun et al., "Efficient BackProp", Neural Networks: Tricks of the
+// Trade, 1998.
+//
+// [4] A. Saxe et al., "Exact solutions to the nonlinear dynamics of learning
+// in deep linear neural networks", ICLR 2014.
+//
+// [5] G. Hinton, "A Practical Guide to Training Restricted Boltzmann
+// Machines", UTML TR 2010-003.
+
+// Initializer fills a weight matrix using rng as the source of randomness.
+// fanIn and fanOut are the number of input and output units connected by
+// the matrix, which doesn't depend on its layout.
+type Initializer interface {
+	Init(w *nnet.Matrix, fanIn, fanOut int, rng *rand.Rand)
+}
+
+// Uniform draws weights from U(Min, Max).
+type Uniform struct {
+	Min, Max float64
+}
+
+func (u Uniform) Init(w *nnet.Matrix, fanIn, fanOut int, rng *rand.Rand) {
+	fill(w, func() float64 { return u.Min + (u.Max-u.Min)*rng.Float64() })
+}
+
+// Normal draws weights from N(Mean, Std^2).
+type Normal struct {
+	Mean, Std float64
+}
+
+func (n Normal) Init(w *nnet.Matrix, fanIn, fanOut int, rng *rand.Rand) {
+	fill(w, func() float64 { return n.Mean + n.Std*rng.NormFloat64() })
+}
+
+// Constant sets all weights to Value.
+type Constant struct {
+	Value float64
+}
+
+func (c Constant) Init(w *nnet.Matrix, fanIn, fanOut int, rng *rand.Rand) {
+	fill(w, func() float64 { return c.Value })
+}
+
+// Zero sets all weights to zero.
+var Zero = Constant{0.0}
+
+// GlorotUniform draws weights from U(-a, a), a = sqrt(6/(fanIn+fanOut)).
+// Also known as Xavier initialization [1].
+type GlorotUniform struct{}
+
+func (GlorotUniform) Init(w *nnet.Matrix, fanIn, fanOut int, rng *rand.Rand) {
+	a := math.Sqrt(6.0 / float64(fanIn+fanOut))
+	Uniform{-a, a}.Init(w, fanIn, fanOut, rng)
+}
+
+// GlorotNormal draws weights from N(0, 2/(fanIn+fanOut)) [1].
+type GlorotNormal struct{}
+
+func (GlorotNormal) Init(w *nnet.Matrix, fanIn, fanOut int, rng *rand.Rand) {
+	Normal{0, math.Sqrt(2.0 / float64(fanIn+fanOut))}.Init(w, fanIn, fanOut, rng)
+}
+
+// HeUniform draws weights from U(-a, a), a = sqrt(6/fanIn), which suits
+// ReLU layers [2].
+type HeUniform struct{}
+
+func (HeUniform) Init(w *nnet.Matrix, fanIn, fanOut int, rng *rand.Rand) {
+	a := math.Sqrt(6.0 / float64(fanIn))
+	Uniform{-a, a}.Init(w, fanIn, fanOut, rng)
+}
+
+// HeNormal draws weights from N(0, 2/fanIn) [2].
+type HeNormal struct{}
+
+func (HeNormal) Init(w *nnet.Matrix, fanIn, fanOut int, rng *rand.Rand) {
+	Normal{0, math.Sqrt(2.0 / float64(fanIn))}.Init(w, fanIn, fanOut, rng)
+}
+
+// LeCunUniform draws weights from U(-a, a), a = sqrt(3/fanIn) [3].
+type LeCunUniform struct{}
+
+func (LeCunUniform) Init(w *nnet.Matrix, fanIn, fanOut int, rng *rand.Rand) {
+	a := math.Sqrt(3.0 / float64(fanIn))
+	Uniform{-a, a}.Init(w, fanIn, fanOut, rng)
+}
+
+// LeCunNormal draws weights from N(0, 1/fanIn) [3].
+type LeCunNormal struct{}
+
+func (LeCunNormal) Init(w *nnet.Matrix, fanIn, fanOut int, rng *rand.Rand) {
+	Normal{0, math.Sqrt(1.0 / float64(fanIn))}.Init(w, fanIn, fanOut, rng)
+}
+
+// Orthogonal sets the weights to a random (semi-)orthogonal matrix scaled
+// by Gain, which is usually 1. The rows are orthonormal if there are no
+// more rows than columns, otherwise the columns are [4].
+type Orthogonal struct {
+	Gain float64
+}
+
+func (o Orthogonal) Init(w *nnet.Matrix, fanIn, fanOut int, rng *rand.Rand) {
+	rows, cols := w.Dims()
+	transposed := rows > cols
+	if transposed {
+		rows, cols = cols, rows
+	}
+
+	// Gram-Schmidt orthonormalization of random Gaussian vectors
+	q := nnet.NewMatrix(rows, cols)
+	for i := 0; i < rows; i++ {
+		v := q.Row(i)
+		for {
+			for j := range v {
+				v[j] = rng.NormFloat64()
+			}
+			for k := 0; k < i; k++ {
+				nnet.Axpy(-nnet.Dot(q.Row(k), v), q.Row(k), v)
+			}
+			norm := math.Sqrt(nnet.Dot(v, v))
+			if norm > 1.0e-8 {
+				for j := range v {
+					v[j] *= o.Gain / norm
+				}
+				break
+			}
+		}
+	}
+
+	if transposed {
+		q = q.T()
+	}
+	w.Copy(q)
+}
+
+// VisibleBias returns the visible biases log(p_j/(1-p_j)) of a binary RBM,
+// where p_j is the proportion of training vectors in which unit j is on [5].
+func VisibleBias(data [][]float64) []float64 {
+	eps := 1.0e-4
+	bias := make([]float64, len(data[0]))
+	for _, v := range data {
+		for j := range bias {
+			bias[j] += v[j]
+		}
+	}
+	for j := range bias {
+		p := math.Min(math.Max(bias[j]/float64(len(data)), eps), 1.0-eps)
+		bias[j] = math.Log(p / (1.0 - p))
+	}
+	return bias
+}
+
+func fill(w *nnet.Matrix, f func() float64) {
+	for i := 0; i < w.Rows; i++ {
+		row := w.Row(i)
+		for j := range row {
+			row[j] = f()
+		}
+	}
+}
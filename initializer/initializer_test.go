@@ -0,0 +1,50 @@
+package initializer
+
+import (
+	"github.com/r9y9/nnet"
+	"math"
+	"testing"
+)
+
+func TestOrthogonal(t *testing.T) {
+	for _, shape := range [][2]int{{3, 5}, {5, 3}} {
+		w := nnet.NewMatrix(shape[0], shape[1])
+		Orthogonal{Gain: 1.0}.Init(w, shape[1], shape[0], nnet.NewRand(1))
+
+		// W*W^T (or W^T*W) must be identity
+		p := nnet.Mul(w, w.T())
+		if shape[0] > shape[1] {
+			p = nnet.Mul(w.T(), w)
+		}
+		for i := 0; i < p.Rows; i++ {
+			for j := 0; j < p.Cols; j++ {
+				want := 0.0
+				if i == j {
+					want = 1.0
+				}
+				if math.Abs(p.At(i, j)-want) > 1.0e-10 {
+					t.Fatalf("%v is not orthogonal.", w.ToRows())
+				}
+			}
+		}
+	}
+}
+
+func TestGlorotUniform(t *testing.T) {
+	w := nnet.NewMatrix(40, 60)
+	GlorotUniform{}.Init(w, 40, 60, nnet.NewRand(1))
+	a := math.Sqrt(6.0 / 100.0)
+	for _, v := range w.Data {
+		if math.Abs(v) > a {
+			t.Fatalf("Weight %f exceeds %f.", v, a)
+		}
+	}
+}
+
+func TestVisibleBias(t *testing.T) {
+	bias := VisibleBias([][]float64{{1, 0}, {1, 1}, {0, 0}, {1, 0}})
+	if math.Abs(bias[0]-math.Log(3.0)) > 1.0e-12 ||
+		math.Abs(bias[1]+math.Log(3.0)) > 1.0e-12 {
+		t.Errorf("VisibleBias returns %v, want [log(3) -log(3)].", bias)
+	}
+}
@@ -0,0 +1,152 @@
+package nnet
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// LogFormat is the output format of Logger.
+type LogFormat int
+
+const (
+	CSV       LogFormat = iota // comma separated values with a header line
+	JSONLines                  // one json object per line
+)
+
+// Logger is a callback that writes one record per epoch. A record holds the
+// epoch, the metrics of the epoch (e.g. "objective" and "validation_*"),
+// the metrics of the last mini-batch (e.g. "learning_rate"), the gradient
+// norms ("grad_norm*") averaged over the mini-batches of the epoch, and
+//
+//	time             seconds since the first epoch began
+//	epoch_time       seconds spent in the epoch
+//	samples_per_sec  training samples processed per second in the epoch
+//
+// The CSV header is taken from the first record; keys that only appear
+// later are not written in CSV.
+type Logger struct {
+	BaseCallback
+
+	format  LogFormat
+	w       io.Writer
+	csv     *csv.Writer
+	columns []string
+
+	start      time.Time
+	epochStart time.Time
+	samples    int
+	norms      gradNorms
+	batch      Metrics
+}
+
+// NewLogger returns a logger that writes records to w in the given format.
+func NewLogger(w io.Writer, format LogFormat) *Logger {
+	l := &Logger{format: format, w: w}
+	if format == CSV {
+		l.csv = csv.NewWriter(w)
+	}
+	return l
+}
+
+func (l *Logger) OnEpochBegin(model interface{}, epoch int) error {
+	l.epochStart = time.Now()
+	if l.start.IsZero() {
+		l.start = l.epochStart
+	}
+	l.samples, l.batch = 0, nil
+	l.norms.reset()
+	return nil
+}
+
+func (l *Logger) OnBatchEnd(model interface{}, epoch, batch int,
+	metrics Metrics) error {
+	l.samples += int(metrics["batch_size"])
+	l.norms.add(metrics)
+	l.batch = metrics
+	return nil
+}
+
+func (l *Logger) OnEpochEnd(model interface{}, epoch int,
+	metrics Metrics) error {
+	now := time.Now()
+	record := Metrics{}
+	for k, v := range l.batch {
+		if k != "batch_size" {
+			record[k] = v
+		}
+	}
+	for k, v := range metrics {
+		record[k] = v
+	}
+	for k, v := range l.norms.means() {
+		record[k] = v
+	}
+	elapsed := now.Sub(l.epochStart).Seconds()
+	record["time"] = now.Sub(l.start).Seconds()
+	record["epoch_time"] = elapsed
+	record["samples_per_sec"] = 0
+	if elapsed > 0 {
+		record["samples_per_sec"] = float64(l.samples) / elapsed
+	}
+	return l.write(epoch, record)
+}
+
+func (l *Logger) write(epoch int, record Metrics) error {
+	switch l.format {
+	case CSV:
+		return l.writeCSV(epoch, record)
+	case JSONLines:
+		return l.writeJSON(epoch, record)
+	}
+	return fmt.Errorf("nnet: unknown log format %d", l.format)
+}
+
+func (l *Logger) writeCSV(epoch int, record Metrics) error {
+	if l.columns == nil {
+		for k := range record {
+			l.columns = append(l.columns, k)
+		}
+		sort.Strings(l.columns)
+		l.csv.Write(append([]string{"epoch"}, l.columns...))
+	}
+	row := []string{strconv.Itoa(epoch)}
+	for _, k := range l.columns {
+		v, ok := record[k]
+		if !ok {
+			row = append(row, "")
+			continue
+		}
+		row = append(row, strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	l.csv.Write(row)
+
+	// Flush every record so that the log is complete if training is
+	// interrupted.
+	l.csv.Flush()
+	return l.csv.Error()
+}
+
+func (l *Logger) writeJSON(epoch int, record Metrics) error {
+	fields := make(map[string]interface{}, len(record)+1)
+	for k, v := range record {
+		// json can't encode NaN and infinities
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			fields[k] = strconv.FormatFloat(v, 'g', -1, 64)
+			continue
+		}
+		fields[k] = v
+	}
+	fields["epoch"] = epoch
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	_, err = l.w.Write(append(b, '\n'))
+	return err
+}
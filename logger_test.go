@@ -0,0 +1,75 @@
+package nnet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func trainWithLogger(t *testing.T, format LogFormat) string {
+	var buf bytes.Buffer
+	trainer := NewTrainer(BaseTrainingOption{
+		Epoches:       2,
+		MiniBatchSize: 2,
+		Callbacks:     []Callback{NewLogger(&buf, format)},
+	})
+	m := &counterModel{value: []float64{0}}
+	if err := trainer.UnSupervisedMiniBatchTrain(m, MakeMatrix(5, 1)); err != nil {
+		t.Fatalf("Train returns %v, want no error.", err)
+	}
+	return buf.String()
+}
+
+func TestLoggerCSV(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(
+		trainWithLogger(t, CSV))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Logger writes %d lines, want 3.", len(records))
+	}
+
+	header := []string{"epoch", "epoch_time", "grad_norm", "grad_norm/value",
+		"objective", "samples_per_sec", "time"}
+	if !reflect.DeepEqual(records[0], header) {
+		t.Errorf("Header is %v, want %v.", records[0], header)
+	}
+	// 3 updates per epoch, objective is |updates - 4|
+	for epoch, objective := range []string{"1", "2"} {
+		row := records[epoch+1]
+		if row[0] != []string{"0", "1"}[epoch] || row[2] != "0" ||
+			row[4] != objective {
+			t.Errorf("Record of epoch %d is %v.", epoch, row)
+		}
+	}
+}
+
+func TestLoggerJSONLines(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(trainWithLogger(t, JSONLines)),
+		"\n")
+	if len(lines) != 2 {
+		t.Fatalf("Logger writes %d lines, want 2.", len(lines))
+	}
+	for epoch, line := range lines {
+		var record map[string]float64
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record["epoch"] != float64(epoch) {
+			t.Errorf("epoch is %v, want %d.", record["epoch"], epoch)
+		}
+		for _, k := range []string{"objective", "grad_norm", "time",
+			"epoch_time"} {
+			if _, ok := record[k]; !ok {
+				t.Errorf("Record %s has no %q.", line, k)
+			}
+		}
+		if _, ok := record["batch_size"]; ok {
+			t.Errorf("Record %s has batch_size.", line)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package nnet
+
+import (
+	"fmt"
+	"math"
+)
+
+// Loss represents a loss function for supervised training. Both Value and
+// Gradient take the output of a network and the corresponding target.
+type Loss interface {
+	// Name returns a name that identifies the loss.
+	Name() string
+
+	// Value returns the loss of a single sample.
+	Value(predicted, target []float64) float64
+
+	// Gradient returns the derivative of the loss with respect to predicted.
+	Gradient(predicted, target []float64) []float64
+}
+
+// NewLoss returns the loss identified by name. The empty name corresponds
+// to MeanSquaredError.
+func NewLoss(name string) (Loss, error) {
+	base, param, hasParam, err := parseName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch base {
+	case "", "mse":
+		return MeanSquaredError{}, nil
+	case "binary_cross_entropy":
+		return BinaryCrossEntropy{}, nil
+	case "cross_entropy":
+		return CrossEntropy{}, nil
+	case "softmax_cross_entropy":
+		return SoftmaxCrossEntropy{}, nil
+	case "huber":
+		if !hasParam {
+			param = 1.0
+		}
+		return Huber{Delta: param}, nil
+	case "multiclass_hinge":
+		if !hasParam {
+			param = 1.0
+		}
+		return MulticlassHinge{Margin: param}, nil
+	}
+
+	return nil, fmt.Errorf("nnet: unknown loss %q", name)
+}
+
+// epsilon keeps logarithms of probabilities finite.
+const epsilon = 1.0e-12
+
+// MeanSquaredError is 0.5 * ||predicted - target||^2.
+type MeanSquaredError struct{}
+
+func (MeanSquaredError) Name() string { return "mse" }
+
+func (MeanSquaredError) Value(predicted, target []float64) float64 {
+	sum := 0.0
+	for i := range predicted {
+		sum += (predicted[i] - target[i]) * (predicted[i] - target[i])
+	}
+	return 0.5 * sum
+}
+
+func (MeanSquaredError) Gradient(predicted, target []float64) []float64 {
+	grad := make([]float64, len(predicted))
+	for i := range grad {
+		grad[i] = predicted[i] - target[i]
+	}
+	return grad
+}
+
+// BinaryCrossEntropy is the cross-entropy between independent Bernoulli
+// distributions, -sum_i t_i*log(p_i) + (1-t_i)*log(1-p_i). Predictions are
+// expected to be probabilities, e.g. outputs of a sigmoid layer.
+type BinaryCrossEntropy struct{}
+
+func (BinaryCrossEntropy) Name() string { return "binary_cross_entropy" }
+
+func (BinaryCrossEntropy) Value(predicted, target []float64) float64 {
+	sum := 0.0
+	for i := range predicted {
+		p := clip(predicted[i], epsilon, 1.0-epsilon)
+		sum -= target[i]*math.Log(p) + (1.0-target[i])*math.Log(1.0-p)
+	}
+	return sum
+}
+
+func (BinaryCrossEntropy) Gradient(predicted, target []float64) []float64 {
+	grad := make([]float64, len(predicted))
+	for i := range grad {
+		p := clip(predicted[i], epsilon, 1.0-epsilon)
+		grad[i] = (p - target[i]) / (p * (1.0 - p))
+	}
+	return grad
+}
+
+// CrossEntropy is the cross-entropy -sum_i t_i*log(p_i) between the target
+// distribution and the predictions. Predictions are expected to be
+// probabilities, e.g. outputs of a softmax layer. See OutputDelta for the
+// gradient through softmax.
+type CrossEntropy struct{}
+
+func (CrossEntropy) Name() string { return "cross_entropy" }
+
+func (CrossEntropy) Value(predicted, target []float64) float64 {
+	sum := 0.0
+	for i := range predicted {
+		sum -= target[i] * math.Log(math.Max(predicted[i], epsilon))
+	}
+	return sum
+}
+
+func (CrossEntropy) Gradient(predicted, target []float64) []float64 {
+	grad := make([]float64, len(predicted))
+	for i := range grad {
+		grad[i] = -target[i] / math.Max(predicted[i], epsilon)
+	}
+	return grad
+}
+
+// OutputDelta returns the gradient of loss with respect to the
+// pre-activations of an output layer, whose activations are predicted.
+// For softmax with cross-entropy it is computed directly as
+// p*sum_i(t_i) - t, which avoids dividing by small probabilities.
+func OutputDelta(activation Activation, loss Loss,
+	predicted, target []float64) []float64 {
+	_, softmax := activation.(Softmax)
+	if _, ok := loss.(CrossEntropy); ok && softmax {
+		sumTarget := 0.0
+		for _, t := range target {
+			sumTarget += t
+		}
+		delta := make([]float64, len(predicted))
+		for i := range delta {
+			delta[i] = predicted[i]*sumTarget - target[i]
+		}
+		return delta
+	}
+
+	delta := loss.Gradient(predicted, target)
+	activation.Backward(predicted, delta)
+	return delta
+}
+
+// SoftmaxCrossEntropy applies softmax to the predictions and returns its
+// cross-entropy with the target distribution. Predictions are expected to
+// be unnormalized scores (logits), e.g. outputs of a linear layer.
+type SoftmaxCrossEntropy struct{}
+
+func (SoftmaxCrossEntropy) Name() string { return "softmax_cross_entropy" }
+
+func (SoftmaxCrossEntropy) Value(predicted, target []float64) float64 {
+	max := -math.MaxFloat64
+	for _, v := range predicted {
+		if v > max {
+			max = v
+		}
+	}
+	sum := 0.0
+	for _, v := range predicted {
+		sum += math.Exp(v - max)
+	}
+	logSumExp := max + math.Log(sum)
+
+	loss := 0.0
+	for i := range predicted {
+		loss -= target[i] * (predicted[i] - logSumExp)
+	}
+	return loss
+}
+
+func (SoftmaxCrossEntropy) Gradient(predicted, target []float64) []float64 {
+	grad := make([]float64, len(predicted))
+	copy(grad, predicted)
+	Softmax{}.Forward(grad)
+	sumTarget := 0.0
+	for _, t := range target {
+		sumTarget += t
+	}
+	for i := range grad {
+		grad[i] = grad[i]*sumTarget - target[i]
+	}
+	return grad
+}
+
+// Huber is quadratic for residuals smaller than Delta and linear otherwise,
+// which makes it less sensitive to outliers than MeanSquaredError.
+type Huber struct {
+	Delta float64
+}
+
+func (l Huber) Name() string { return nameWithParam("huber", l.Delta) }
+
+func (l Huber) Value(predicted, target []float64) float64 {
+	sum := 0.0
+	for i := range predicted {
+		r := math.Abs(predicted[i] - target[i])
+		if r <= l.Delta {
+			sum += 0.5 * r * r
+		} else {
+			sum += l.Delta * (r - 0.5*l.Delta)
+		}
+	}
+	return sum
+}
+
+func (l Huber) Gradient(predicted, target []float64) []float64 {
+	grad := make([]float64, len(predicted))
+	for i := range grad {
+		grad[i] = clip(predicted[i]-target[i], -l.Delta, l.Delta)
+	}
+	return grad
+}
+
+// MulticlassHinge is the multiclass SVM loss
+// sum_{j != y} max(0, Margin - s_y + s_j), where s are the predicted scores
+// and y is the index of the largest target value.
+type MulticlassHinge struct {
+	Margin float64
+}
+
+func (l MulticlassHinge) Name() string {
+	return nameWithParam("multiclass_hinge", l.Margin)
+}
+
+func (l MulticlassHinge) Value(predicted, target []float64) float64 {
+	y := Argmax(target)
+	sum := 0.0
+	for j := range predicted {
+		if j == y {
+			continue
+		}
+		sum += math.Max(0, l.Margin-predicted[y]+predicted[j])
+	}
+	return sum
+}
+
+func (l MulticlassHinge) Gradient(predicted, target []float64) []float64 {
+	y := Argmax(target)
+	grad := make([]float64, len(predicted))
+	for j := range predicted {
+		if j == y {
+			continue
+		}
+		if l.Margin-predicted[y]+predicted[j] > 0 {
+			grad[j] += 1.0
+			grad[y] -= 1.0
+		}
+	}
+	return grad
+}
+
+func clip(x, min, max float64) float64 {
+	return math.Min(math.Max(x, min), max)
+}
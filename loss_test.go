@@ -0,0 +1,66 @@
+package nnet
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLossGradient(t *testing.T) {
+	losses := []Loss{
+		MeanSquaredError{}, BinaryCrossEntropy{}, CrossEntropy{},
+		SoftmaxCrossEntropy{}, Huber{Delta: 0.5}, MulticlassHinge{Margin: 1.0},
+	}
+	predicted := []float64{0.2, 0.7, 0.45}
+	target := []float64{0.0, 1.0, 0.0}
+	eps := 1.0e-6
+
+	for _, l := range losses {
+		grad := l.Gradient(predicted, target)
+		for i := range predicted {
+			p := append([]float64(nil), predicted...)
+			m := append([]float64(nil), predicted...)
+			p[i] += eps
+			m[i] -= eps
+			numerical := (l.Value(p, target) - l.Value(m, target)) / (2 * eps)
+			if math.Abs(numerical-grad[i]) > 1.0e-5 {
+				t.Errorf("%s: gradient %f at %d, want %f.",
+					l.Name(), grad[i], i, numerical)
+			}
+		}
+
+		restored, err := NewLoss(l.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored != l {
+			t.Errorf("NewLoss(%q) returns %v, want %v.", l.Name(), restored, l)
+		}
+	}
+}
+
+func TestOutputDelta(t *testing.T) {
+	z := []float64{0.5, -1.0, 2.0}
+	target := []float64{0.2, 0.0, 0.8}
+	predicted := append([]float64(nil), z...)
+	Softmax{}.Forward(predicted)
+
+	// Softmax with cross-entropy is the same as cross-entropy on logits
+	delta := OutputDelta(Softmax{}, CrossEntropy{}, predicted, target)
+	want := SoftmaxCrossEntropy{}.Gradient(z, target)
+	for i := range want {
+		if math.Abs(delta[i]-want[i]) > 1.0e-12 {
+			t.Errorf("OutputDelta returns %v, want %v.", delta, want)
+			break
+		}
+	}
+
+	// Other combinations backpropagate the gradient of the loss
+	delta = OutputDelta(SigmoidActivation{}, MeanSquaredError{}, predicted,
+		target)
+	for i := range delta {
+		want := (predicted[i] - target[i]) * predicted[i] * (1 - predicted[i])
+		if math.Abs(delta[i]-want) > 1.0e-12 {
+			t.Errorf("OutputDelta returns %v at %d, want %v.", delta[i], i, want)
+		}
+	}
+}
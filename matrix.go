@@ -0,0 +1,338 @@
+package nnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Matrix is a dense matrix of float64 values stored in row-major order.
+// Element (i, j) is located at Data[i*Stride+j]. A matrix created by
+// NewMatrix is contiguous (Stride == Cols); views returned by View share
+// storage with their parent and may have a larger stride.
+type Matrix struct {
+	Rows   int
+	Cols   int
+	Stride int
+	Data   []float64
+}
+
+// NewMatrix creates a new zero-filled matrix of the given shape.
+func NewMatrix(rows, cols int) *Matrix {
+	if rows < 0 || cols < 0 {
+		panic(fmt.Sprintf("nnet: negative matrix dimension %dx%d", rows, cols))
+	}
+	return &Matrix{
+		Rows:   rows,
+		Cols:   cols,
+		Stride: cols,
+		Data:   make([]float64, rows*cols),
+	}
+}
+
+// NewMatrixFromData creates a matrix that uses data as its backing storage.
+// The length of data must be rows*cols.
+func NewMatrixFromData(rows, cols int, data []float64) *Matrix {
+	if len(data) != rows*cols {
+		panic(fmt.Sprintf("nnet: data length %d doesn't match shape %dx%d",
+			len(data), rows, cols))
+	}
+	return &Matrix{Rows: rows, Cols: cols, Stride: cols, Data: data}
+}
+
+// NewMatrixFromRows creates a contiguous matrix by copying a slice of rows.
+func NewMatrixFromRows(rows [][]float64) *Matrix {
+	if len(rows) == 0 {
+		return NewMatrix(0, 0)
+	}
+	m := NewMatrix(len(rows), len(rows[0]))
+	for i, row := range rows {
+		if len(row) != m.Cols {
+			panic(fmt.Sprintf("nnet: row %d has length %d, want %d",
+				i, len(row), m.Cols))
+		}
+		copy(m.Row(i), row)
+	}
+	return m
+}
+
+// Dims returns the number of rows and columns.
+func (m *Matrix) Dims() (int, int) {
+	return m.Rows, m.Cols
+}
+
+// IsContiguous reports whether the elements are stored without gaps,
+// i.e. whether Data can be treated as a flat parameter vector.
+func (m *Matrix) IsContiguous() bool {
+	return m.Stride == m.Cols || m.Rows <= 1
+}
+
+// At returns the element at row i and column j.
+func (m *Matrix) At(i, j int) float64 {
+	m.checkIndex(i, j)
+	return m.Data[i*m.Stride+j]
+}
+
+// Set sets the element at row i and column j to v.
+func (m *Matrix) Set(i, j int, v float64) {
+	m.checkIndex(i, j)
+	m.Data[i*m.Stride+j] = v
+}
+
+func (m *Matrix) checkIndex(i, j int) {
+	if i < 0 || i >= m.Rows || j < 0 || j >= m.Cols {
+		panic(fmt.Sprintf("nnet: index (%d, %d) out of range for %dx%d matrix",
+			i, j, m.Rows, m.Cols))
+	}
+}
+
+// Row returns the i-th row. The returned slice shares storage with m.
+func (m *Matrix) Row(i int) []float64 {
+	if i < 0 || i >= m.Rows {
+		panic(fmt.Sprintf("nnet: row %d out of range for %dx%d matrix",
+			i, m.Rows, m.Cols))
+	}
+	b := i * m.Stride
+	return m.Data[b : b+m.Cols : b+m.Cols]
+}
+
+// Col returns a copy of the j-th column.
+func (m *Matrix) Col(j int) []float64 {
+	m.checkIndex(0, j)
+	col := make([]float64, m.Rows)
+	for i := range col {
+		col[i] = m.Data[i*m.Stride+j]
+	}
+	return col
+}
+
+// View returns a rows x cols submatrix starting at (i, j). The view shares
+// storage with m, so modifications of the view are visible in m.
+func (m *Matrix) View(i, j, rows, cols int) *Matrix {
+	if i < 0 || j < 0 || rows < 0 || cols < 0 ||
+		i+rows > m.Rows || j+cols > m.Cols {
+		panic(fmt.Sprintf("nnet: view (%d, %d, %d, %d) out of range for %dx%d matrix",
+			i, j, rows, cols, m.Rows, m.Cols))
+	}
+	if rows == 0 || cols == 0 {
+		return &Matrix{Rows: rows, Cols: cols, Stride: m.Stride}
+	}
+	b := i*m.Stride + j
+	e := (i+rows-1)*m.Stride + j + cols
+	return &Matrix{Rows: rows, Cols: cols, Stride: m.Stride, Data: m.Data[b:e]}
+}
+
+// T returns the transpose of m as a new contiguous matrix.
+func (m *Matrix) T() *Matrix {
+	t := NewMatrix(m.Cols, m.Rows)
+	for i := 0; i < m.Rows; i++ {
+		row := m.Row(i)
+		for j, v := range row {
+			t.Data[j*t.Stride+i] = v
+		}
+	}
+	return t
+}
+
+// Clone returns a contiguous deep copy of m.
+func (m *Matrix) Clone() *Matrix {
+	c := NewMatrix(m.Rows, m.Cols)
+	c.Copy(m)
+	return c
+}
+
+// Copy copies the elements of src into m. Both must have the same shape.
+func (m *Matrix) Copy(src *Matrix) {
+	m.checkSameShape(src)
+	for i := 0; i < m.Rows; i++ {
+		copy(m.Row(i), src.Row(i))
+	}
+}
+
+// Zero sets all elements to zero.
+func (m *Matrix) Zero() {
+	for i := 0; i < m.Rows; i++ {
+		row := m.Row(i)
+		for j := range row {
+			row[j] = 0.0
+		}
+	}
+}
+
+// Scale multiplies all elements by f.
+func (m *Matrix) Scale(f float64) {
+	for i := 0; i < m.Rows; i++ {
+		row := m.Row(i)
+		for j := range row {
+			row[j] *= f
+		}
+	}
+}
+
+// AddScaled performs m += alpha * b.
+func (m *Matrix) AddScaled(alpha float64, b *Matrix) {
+	m.checkSameShape(b)
+	for i := 0; i < m.Rows; i++ {
+		Axpy(alpha, b.Row(i), m.Row(i))
+	}
+}
+
+// AddOuter performs the rank-one update m += alpha * x * y^T, where
+// len(x) == m.Rows and len(y) == m.Cols.
+func (m *Matrix) AddOuter(alpha float64, x, y []float64) {
+	if len(x) != m.Rows || len(y) != m.Cols {
+		panic(fmt.Sprintf("nnet: outer product %dx%d doesn't match %dx%d matrix",
+			len(x), len(y), m.Rows, m.Cols))
+	}
+	for i, xi := range x {
+		if xi == 0 {
+			continue
+		}
+		Axpy(alpha*xi, y, m.Row(i))
+	}
+}
+
+// MulVec computes dst = m * x and returns dst. If dst is nil a new slice
+// is allocated.
+func (m *Matrix) MulVec(x, dst []float64) []float64 {
+	if len(x) != m.Cols {
+		panic(fmt.Sprintf("nnet: vector length %d doesn't match %dx%d matrix",
+			len(x), m.Rows, m.Cols))
+	}
+	dst = prepareVec(dst, m.Rows)
+	for i := 0; i < m.Rows; i++ {
+		dst[i] = Dot(m.Row(i), x)
+	}
+	return dst
+}
+
+// MulVecTrans computes dst = m^T * x and returns dst. If dst is nil a new
+// slice is allocated.
+func (m *Matrix) MulVecTrans(x, dst []float64) []float64 {
+	if len(x) != m.Rows {
+		panic(fmt.Sprintf("nnet: vector length %d doesn't match transposed %dx%d matrix",
+			len(x), m.Rows, m.Cols))
+	}
+	dst = prepareVec(dst, m.Cols)
+	for j := range dst {
+		dst[j] = 0.0
+	}
+	for i, xi := range x {
+		if xi == 0 {
+			continue
+		}
+		Axpy(xi, m.Row(i), dst)
+	}
+	return dst
+}
+
+// Mul returns the matrix product a * b.
+func Mul(a, b *Matrix) *Matrix {
+	if a.Cols != b.Rows {
+		panic(fmt.Sprintf("nnet: can't multiply %dx%d by %dx%d matrix",
+			a.Rows, a.Cols, b.Rows, b.Cols))
+	}
+	c := NewMatrix(a.Rows, b.Cols)
+	for i := 0; i < a.Rows; i++ {
+		ci := c.Row(i)
+		for k, aik := range a.Row(i) {
+			if aik == 0 {
+				continue
+			}
+			Axpy(aik, b.Row(k), ci)
+		}
+	}
+	return c
+}
+
+// ToRows returns a copy of m as a slice of rows.
+func (m *Matrix) ToRows() [][]float64 {
+	rows := make([][]float64, m.Rows)
+	for i := range rows {
+		rows[i] = make([]float64, m.Cols)
+		copy(rows[i], m.Row(i))
+	}
+	return rows
+}
+
+func (m *Matrix) checkSameShape(b *Matrix) {
+	if m.Rows != b.Rows || m.Cols != b.Cols {
+		panic(fmt.Sprintf("nnet: shape mismatch %dx%d and %dx%d",
+			m.Rows, m.Cols, b.Rows, b.Cols))
+	}
+}
+
+// jsonMatrix is the serialized form of Matrix. Data is always contiguous.
+type jsonMatrix struct {
+	Rows int
+	Cols int
+	Data []float64
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m *Matrix) MarshalJSON() ([]byte, error) {
+	data := m.Data
+	if !m.IsContiguous() {
+		data = m.Clone().Data
+	}
+	return json.Marshal(jsonMatrix{Rows: m.Rows, Cols: m.Cols, Data: data})
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Arrays of rows, in which
+// dumps of earlier versions stored weights, are also accepted.
+func (m *Matrix) UnmarshalJSON(b []byte) error {
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+		return m.unmarshalRows(b)
+	}
+	var jm jsonMatrix
+	if err := json.Unmarshal(b, &jm); err != nil {
+		return err
+	}
+	if jm.Rows < 0 || jm.Cols < 0 || len(jm.Data) != jm.Rows*jm.Cols {
+		return fmt.Errorf("nnet: matrix data length %d doesn't match shape %dx%d",
+			len(jm.Data), jm.Rows, jm.Cols)
+	}
+	m.Rows, m.Cols, m.Stride, m.Data = jm.Rows, jm.Cols, jm.Cols, jm.Data
+	return nil
+}
+
+func (m *Matrix) unmarshalRows(b []byte) error {
+	var rows [][]float64
+	if err := json.Unmarshal(b, &rows); err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if len(row) != len(rows[0]) {
+			return fmt.Errorf("nnet: matrix row %d has length %d, want %d",
+				i, len(row), len(rows[0]))
+		}
+	}
+	*m = *NewMatrixFromRows(rows)
+	return nil
+}
+
+func prepareVec(v []float64, n int) []float64 {
+	if v == nil {
+		return make([]float64, n)
+	}
+	if len(v) != n {
+		panic(fmt.Sprintf("nnet: destination length %d, want %d", len(v), n))
+	}
+	return v
+}
+
+// Dot returns the inner product of x and y.
+func Dot(x, y []float64) float64 {
+	sum := 0.0
+	for i, v := range x {
+		sum += v * y[i]
+	}
+	return sum
+}
+
+// Axpy performs y += alpha * x.
+func Axpy(alpha float64, x, y []float64) {
+	for i, v := range x {
+		y[i] += alpha * v
+	}
+}
@@ -0,0 +1,72 @@
+package nnet
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMatrixMulVec(t *testing.T) {
+	m := NewMatrixFromRows([][]float64{{1, 2, 3}, {4, 5, 6}})
+
+	y := m.MulVec([]float64{1, 0, -1}, nil)
+	if y[0] != -2 || y[1] != -2 {
+		t.Errorf("MulVec returns %v, want [-2 -2].", y)
+	}
+
+	z := m.MulVecTrans([]float64{1, 1}, nil)
+	want := []float64{5, 7, 9}
+	for i := range want {
+		if z[i] != want[i] {
+			t.Errorf("MulVecTrans returns %v, want %v.", z, want)
+			break
+		}
+	}
+}
+
+func TestMatrixViewAndTranspose(t *testing.T) {
+	m := NewMatrixFromRows([][]float64{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}})
+	v := m.View(1, 1, 2, 2)
+	if v.At(0, 0) != 5 || v.At(1, 1) != 9 {
+		t.Errorf("View returns wrong elements %v.", v.ToRows())
+	}
+	v.Set(0, 1, 0)
+	if m.At(1, 2) != 0 {
+		t.Errorf("View doesn't share storage with its parent.")
+	}
+
+	p := Mul(m, m.T())
+	if p.At(0, 0) != 14 || p.At(0, 1) != 1*4+2*5 {
+		t.Errorf("Mul returns wrong elements %v.", p.ToRows())
+	}
+}
+
+func TestMatrixJSON(t *testing.T) {
+	m := NewMatrixFromRows([][]float64{{1, 2, 3}, {4, 5, 6}})
+	b, err := json.Marshal(m.View(0, 1, 2, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v Matrix
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Rows != 2 || v.Cols != 2 || v.At(1, 0) != 5 || v.At(1, 1) != 6 {
+		t.Errorf("Decoded matrix %v, want [[2 3] [5 6]].", v.ToRows())
+	}
+
+	if err := json.Unmarshal([]byte(`{"Rows":2,"Cols":2,"Data":[1]}`), &v); err == nil {
+		t.Errorf("Unmarshal of inconsistent shape returns nil, want error.")
+	}
+
+	// Arrays of rows of earlier dumps
+	if err := json.Unmarshal([]byte(`[[1,2,3],[4,5,6]]`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Rows != 2 || v.Cols != 3 || v.At(1, 0) != 4 {
+		t.Errorf("Decoded matrix %v, want [[1 2 3] [4 5 6]].", v.ToRows())
+	}
+	if err := json.Unmarshal([]byte(`[[1,2],[3]]`), &v); err == nil {
+		t.Errorf("Unmarshal of ragged rows returns nil, want error.")
+	}
+}
@@ -0,0 +1,59 @@
+package nnet
+
+// Metric scores a model on a dataset, e.g. on held-out data during
+// training.
+type Metric interface {
+	// Name identifies the metric in Metrics.
+	Name() string
+
+	// Evaluate returns the score of model on input and target. target is
+	// nil for unsupervised models.
+	Evaluate(model interface{}, input, target [][]float64) float64
+
+	// Maximize reports whether larger scores are better.
+	Maximize() bool
+}
+
+// Objective scores a model by its own objective function, the same that is
+// reported during training. Objectives such as log-likelihoods have to be
+// maximized, which is indicated by Maximize.
+type Objective struct {
+	Maximized bool
+}
+
+func (Objective) Name() string { return "objective" }
+
+func (m Objective) Maximize() bool { return m.Maximized }
+
+func (Objective) Evaluate(model interface{}, input,
+	target [][]float64) float64 {
+	switch u := model.(type) {
+	case SupervisedObjectiver:
+		return u.SupervisedObjective(input, target)
+	case UnSupervisedObjectiver:
+		return u.UnSupervisedObjective(input)
+	}
+	panic("nnet: model has no objective function")
+}
+
+// Accuracy is the rate of inputs whose largest output matches the largest
+// element of the target. The model must be a Forwarder.
+type Accuracy struct{}
+
+func (Accuracy) Name() string { return "accuracy" }
+
+func (Accuracy) Maximize() bool { return true }
+
+func (Accuracy) Evaluate(model interface{}, input,
+	target [][]float64) float64 {
+	if len(input) == 0 {
+		return 0
+	}
+	correct := 0
+	for i, label := range Test(model.(Forwarder), input) {
+		if label == Argmax(target[i]) {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(input))
+}
@@ -0,0 +1,232 @@
+package mlp
+
+import (
+	"fmt"
+	"github.com/r9y9/nnet"
+	"math"
+	"math/rand"
+)
+
+// BatchNorm is a layer that normalizes its inputs, typically the
+// pre-activations of a dense layer with linear activation, to zero mean
+// and unit variance and then scales and shifts them by the learnable Gamma
+// and Beta. In training mode, inputs are normalized by the statistics of
+// the mini-batch, which are accumulated into RunningMean and RunningVar for
+// inference. Its kind is "batch_norm".
+// refs: S. Ioffe and C. Szegedy, "Batch Normalization: Accelerating Deep
+// Network Training by Reducing Internal Covariate Shift", ICML 2015.
+type BatchNorm struct {
+	Gamma       []float64
+	Beta        []float64
+	RunningMean []float64
+	RunningVar  []float64
+	Momentum    float64   // weight of the running statistics in each update
+	Epsilon     float64   // added to variances for numerical stability
+	GradGamma   []float64 `json:"-"`
+	GradBeta    []float64 `json:"-"`
+
+	cache *normCache // of the last ForwardBatch
+}
+
+// NewBatchNorm returns a batch normalization of n units that initially
+// passes normalized inputs through.
+func NewBatchNorm(n int) *BatchNorm {
+	b := &BatchNorm{
+		Gamma:       make([]float64, n),
+		Beta:        make([]float64, n),
+		RunningMean: make([]float64, n),
+		RunningVar:  make([]float64, n),
+		Momentum:    0.9,
+		Epsilon:     1.0e-5,
+	}
+	for i := range b.Gamma {
+		b.Gamma[i] = 1.0
+		b.RunningVar[i] = 1.0
+	}
+	return b
+}
+
+// Kind implements Layer.
+func (b *BatchNorm) Kind() string {
+	return "batch_norm"
+}
+
+// Size implements Sized.
+func (b *BatchNorm) Size() (int, int) {
+	return len(b.Gamma), len(b.Gamma)
+}
+
+// check returns an error if the parameters don't have the same number of
+// units.
+func (b *BatchNorm) check(layer int) error {
+	n := len(b.Gamma)
+	prefix := fmt.Sprintf("layer %d batch norm ", layer)
+	for _, v := range []struct {
+		what   string
+		values []float64
+	}{
+		{"beta", b.Beta},
+		{"running mean", b.RunningMean},
+		{"running variance", b.RunningVar},
+	} {
+		if err := nnet.CheckSize(prefix+v.what, n, len(v.values)); err != nil {
+			return err
+		}
+	}
+	if b.Epsilon <= 0 {
+		return fmt.Errorf("mlp: batch norm epsilon %v of layer %d is not positive",
+			b.Epsilon, layer)
+	}
+	return nil
+}
+
+// Forward normalizes input by the running statistics.
+func (b *BatchNorm) Forward(input []float64) []float64 {
+	output := make([]float64, len(input))
+	for i, x := range input {
+		output[i] = b.Gamma[i]*(x-b.RunningMean[i])/
+			math.Sqrt(b.RunningVar[i]+b.Epsilon) + b.Beta[i]
+	}
+	return output
+}
+
+// normCache keeps what Backward needs from ForwardBatch.
+type normCache struct {
+	normalized [][]float64 // inputs before scaling and shifting
+	invStd     []float64
+	training   bool
+}
+
+// ForwardBatch implements Layer. In training, the statistics of the
+// mini-batch are used and the running statistics are updated; otherwise
+// the running statistics are used as in Forward.
+func (b *BatchNorm) ForwardBatch(input [][]float64, training bool,
+	rng *rand.Rand) [][]float64 {
+	mean, variance := b.RunningMean, b.RunningVar
+	if training {
+		mean, variance = b.statistics(input)
+	}
+
+	c := &normCache{
+		normalized: make([][]float64, len(input)),
+		invStd:     make([]float64, len(mean)),
+		training:   training,
+	}
+	for i := range c.invStd {
+		c.invStd[i] = 1.0 / math.Sqrt(variance[i]+b.Epsilon)
+	}
+	output := make([][]float64, len(input))
+	for n := range input {
+		c.normalized[n] = make([]float64, len(input[n]))
+		output[n] = make([]float64, len(input[n]))
+		for i, x := range input[n] {
+			c.normalized[n][i] = (x - mean[i]) * c.invStd[i]
+			output[n][i] = b.Gamma[i]*c.normalized[n][i] + b.Beta[i]
+		}
+	}
+	b.cache = c
+	return output
+}
+
+// statistics returns the mean and the biased variance of a mini-batch and
+// updates the running statistics, which use the unbiased variance.
+func (b *BatchNorm) statistics(x [][]float64) ([]float64, []float64) {
+	n := float64(len(x))
+	mean := make([]float64, len(b.Gamma))
+	variance := make([]float64, len(b.Gamma))
+	for i := range mean {
+		for _, row := range x {
+			mean[i] += row[i]
+		}
+		mean[i] /= n
+		for _, row := range x {
+			variance[i] += (row[i] - mean[i]) * (row[i] - mean[i])
+		}
+		variance[i] /= n
+	}
+
+	correction := 1.0
+	if len(x) > 1 {
+		correction = n / (n - 1)
+	}
+	for i := range mean {
+		b.RunningMean[i] = b.Momentum*b.RunningMean[i] +
+			(1.0-b.Momentum)*mean[i]
+		b.RunningVar[i] = b.Momentum*b.RunningVar[i] +
+			(1.0-b.Momentum)*correction*variance[i]
+	}
+	return mean, variance
+}
+
+// Backward implements Layer.
+func (b *BatchNorm) Backward(grad [][]float64) [][]float64 {
+	c := b.cache
+	n := float64(len(grad))
+	b.GradGamma = make([]float64, len(b.Gamma))
+	b.GradBeta = make([]float64, len(b.Beta))
+	for k := range grad {
+		for i, d := range grad[k] {
+			b.GradGamma[i] += d * c.normalized[k][i]
+			b.GradBeta[i] += d
+		}
+	}
+
+	result := make([][]float64, len(grad))
+	for k := range grad {
+		result[k] = make([]float64, len(grad[k]))
+		for i, d := range grad[k] {
+			if !c.training {
+				result[k][i] = b.Gamma[i] * c.invStd[i] * d
+				continue
+			}
+			// Batch statistics depend on every sample of the mini-batch
+			result[k][i] = b.Gamma[i] * c.invStd[i] *
+				(d - b.GradBeta[i]/n - c.normalized[k][i]*b.GradGamma[i]/n)
+		}
+	}
+	return result
+}
+
+// Params implements Layer. It returns Gamma and Beta together with their
+// gradients.
+func (b *BatchNorm) Params() []*nnet.Param {
+	if b.GradGamma == nil {
+		b.GradGamma = make([]float64, len(b.Gamma))
+		b.GradBeta = make([]float64, len(b.Beta))
+	}
+	return []*nnet.Param{
+		{Name: "gamma", Value: b.Gamma, Grad: b.GradGamma},
+		{Name: "beta", Value: b.Beta, Grad: b.GradBeta},
+	}
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (b *BatchNorm) MarshalBinary() ([]byte, error) {
+	var e nnet.BinaryEncoder
+	e.Float64s([]float64{b.Momentum, b.Epsilon})
+	e.Float64s(b.Gamma)
+	e.Float64s(b.Beta)
+	e.Float64s(b.RunningMean)
+	e.Float64s(b.RunningVar)
+	return e.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (b *BatchNorm) UnmarshalBinary(data []byte) error {
+	dec := nnet.NewBinaryDecoder(data)
+	option := dec.Float64s()
+	if dec.Err() == nil && len(option) != 2 {
+		return fmt.Errorf("mlp: batch norm options of length %d, want 2",
+			len(option))
+	}
+	*b = BatchNorm{
+		Gamma:       dec.Float64s(),
+		Beta:        dec.Float64s(),
+		RunningMean: dec.Float64s(),
+		RunningVar:  dec.Float64s(),
+	}
+	if dec.Err() == nil {
+		b.Momentum, b.Epsilon = option[0], option[1]
+	}
+	return dec.Finish()
+}
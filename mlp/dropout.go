@@ -0,0 +1,103 @@
+package mlp
+
+import (
+	"fmt"
+	"github.com/r9y9/nnet"
+	"math/rand"
+)
+
+// Dropout is a layer that drops each of its inputs with probability Rate
+// while the MLP is in training mode. Plain dropout scales inputs by 1-Rate
+// in inference to keep their expectation; inverted dropout scales the kept
+// units by 1/(1-Rate) in training instead and leaves inference unchanged.
+// Its kind is "dropout".
+// refs: N. Srivastava et al., "Dropout: A Simple Way to Prevent Neural
+// Networks from Overfitting", JMLR 2014.
+type Dropout struct {
+	Rate     float64
+	Inverted bool
+
+	masks [][]float64 // of the last ForwardBatch
+}
+
+// Kind implements Layer.
+func (o *Dropout) Kind() string {
+	return "dropout"
+}
+
+func (o *Dropout) check(layer int) error {
+	if o.Rate < 0 || o.Rate >= 1 {
+		return fmt.Errorf("mlp: dropout rate %v of layer %d is not in [0, 1)",
+			o.Rate, layer)
+	}
+	return nil
+}
+
+// mask returns the factors of n input units in training.
+func (o *Dropout) mask(n int, rng *rand.Rand) []float64 {
+	scale := 1.0
+	if o.Inverted {
+		scale = 1.0 / (1.0 - o.Rate)
+	}
+	m := make([]float64, n)
+	for i := range m {
+		if rng.Float64() >= o.Rate {
+			m[i] = scale
+		}
+	}
+	return m
+}
+
+// inferenceScale returns the factor of input units in inference.
+func (o *Dropout) inferenceScale() float64 {
+	if o.Inverted {
+		return 1.0
+	}
+	return 1.0 - o.Rate
+}
+
+// Forward scales input as in inference.
+func (o *Dropout) Forward(input []float64) []float64 {
+	output := make([]float64, len(input))
+	nnet.Axpy(o.inferenceScale(), input, output)
+	return output
+}
+
+// ForwardBatch implements Layer. Masks are drawn from rng in training.
+func (o *Dropout) ForwardBatch(input [][]float64, training bool,
+	rng *rand.Rand) [][]float64 {
+	o.masks = make([][]float64, len(input))
+	output := make([][]float64, len(input))
+	for n := range input {
+		if training {
+			o.masks[n] = o.mask(len(input[n]), rng)
+		} else {
+			o.masks[n] = make([]float64, len(input[n]))
+			for i := range o.masks[n] {
+				o.masks[n][i] = o.inferenceScale()
+			}
+		}
+		output[n] = make([]float64, len(input[n]))
+		for i, x := range input[n] {
+			output[n][i] = x * o.masks[n][i]
+		}
+	}
+	return output
+}
+
+// Backward implements Layer. Dropped units don't propagate gradients.
+func (o *Dropout) Backward(grad [][]float64) [][]float64 {
+	result := make([][]float64, len(grad))
+	for n := range grad {
+		result[n] = make([]float64, len(grad[n]))
+		for i, g := range grad[n] {
+			result[n][i] = g * o.masks[n][i]
+		}
+	}
+	return result
+}
+
+// Params implements Layer. Dropout has no parameters.
+func (o *Dropout) Params() []*nnet.Param {
+	return nil
+}
@@ -1,33 +1,170 @@
 package mlp
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/r9y9/nnet"
+	"github.com/r9y9/nnet/initializer"
 	"math/rand"
 )
 
+// HiddenLayer is a fully connected layer followed by an activation. Its
+// kind is "dense".
 type HiddenLayer struct {
-	W              [][]float64
+	W              *nnet.Matrix
 	B              []float64
 	NumInputUnits  int
 	NumHiddenUnits int
+	Activation     nnet.Activation
+	GradW          *nnet.Matrix `json:"-"`
+	GradB          []float64    `json:"-"`
+
+	input, output [][]float64 // of the last ForwardBatch
+	numWorkers    int
 }
 
-func NewHiddenLayer(numInputUnits, numHiddenUnits int) *HiddenLayer {
+// NewHiddenLayer creates a new fully connected layer. If activation is nil,
+// sigmoid is used. See Init for the initialization of parameters.
+func NewHiddenLayer(numInputUnits, numHiddenUnits int,
+	activation nnet.Activation, init initializer.Initializer,
+	rng *rand.Rand) *HiddenLayer {
+	if activation == nil {
+		activation = nnet.SigmoidActivation{}
+	}
 	h := new(HiddenLayer)
-	h.W = nnet.MakeMatrix(numInputUnits, numHiddenUnits)
+	h.W = nnet.NewMatrix(numInputUnits, numHiddenUnits)
 	h.NumInputUnits = numInputUnits
 	h.NumHiddenUnits = numHiddenUnits
 	h.B = make([]float64, numHiddenUnits)
-	h.Init()
+	h.Activation = activation
+	h.Init(init, rng)
 	return h
 }
 
-// Init performs a heuristic parameter initialization.
-func (h *HiddenLayer) Init() {
-	for i := range h.W {
-		for j := range h.W[i] {
-			h.W[i][j] = rand.Float64() - 0.5
+// hiddenLayer has the same fields as HiddenLayer but no JSON methods.
+type hiddenLayer HiddenLayer
+
+// MarshalJSON implements json.Marshaler. The activation is saved by name.
+func (h *HiddenLayer) MarshalJSON() ([]byte, error) {
+	name := ""
+	if h.Activation != nil {
+		name = h.Activation.Name()
+	}
+	return json.Marshal(&struct {
+		*hiddenLayer
+		Activation string
+	}{(*hiddenLayer)(h), name})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (h *HiddenLayer) UnmarshalJSON(b []byte) error {
+	aux := &struct {
+		*hiddenLayer
+		Activation string
+	}{hiddenLayer: (*hiddenLayer)(h)}
+	if err := json.Unmarshal(b, aux); err != nil {
+		return err
+	}
+	activation, err := nnet.NewActivation(aux.Activation)
+	if err != nil {
+		return err
+	}
+	h.Activation = activation
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (h *HiddenLayer) MarshalBinary() ([]byte, error) {
+	var e nnet.BinaryEncoder
+	encodeHiddenLayer(&e, h)
+	return e.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (h *HiddenLayer) UnmarshalBinary(b []byte) error {
+	dec := nnet.NewBinaryDecoder(b)
+	if err := decodeHiddenLayer(dec, h); err != nil {
+		return err
+	}
+	return dec.Finish()
+}
+
+// encodeHiddenLayer writes the activation, the weight and the bias.
+func encodeHiddenLayer(e *nnet.BinaryEncoder, h *HiddenLayer) {
+	name := ""
+	if h.Activation != nil {
+		name = h.Activation.Name()
+	}
+	e.String(name)
+	e.Matrix(h.W)
+	e.Float64s(h.B)
+}
+
+func decodeHiddenLayer(dec *nnet.BinaryDecoder, h *HiddenLayer) error {
+	name, W, B := dec.String(), dec.Matrix(), dec.Float64s()
+	if dec.Err() != nil {
+		return dec.Err()
+	}
+	if len(B) != W.Cols {
+		return fmt.Errorf("mlp: bias length %d doesn't match weight %dx%d",
+			len(B), W.Rows, W.Cols)
+	}
+	activation, err := nnet.NewActivation(name)
+	if err != nil {
+		return err
+	}
+	*h = HiddenLayer{
+		W:              W,
+		B:              B,
+		NumInputUnits:  W.Rows,
+		NumHiddenUnits: W.Cols,
+		Activation:     activation,
+	}
+	return nil
+}
+
+// check returns a *nnet.ShapeError if the weight and the bias don't match
+// the numbers of units. layer is the index used in the error.
+func (h *HiddenLayer) check(layer int) error {
+	if h.W == nil {
+		return fmt.Errorf("mlp: layer %d has no weight", layer)
+	}
+	prefix := fmt.Sprintf("layer %d ", layer)
+	if err := nnet.CheckSize(prefix+"weight rows", h.NumInputUnits,
+		h.W.Rows); err != nil {
+		return err
+	}
+	if err := nnet.CheckSize(prefix+"weight columns", h.NumHiddenUnits,
+		h.W.Cols); err != nil {
+		return err
+	}
+	return nnet.CheckSize(prefix+"bias", h.NumHiddenUnits, len(h.B))
+}
+
+// Kind implements Layer.
+func (h *HiddenLayer) Kind() string {
+	return "dense"
+}
+
+// Size implements Sized.
+func (h *HiddenLayer) Size() (int, int) {
+	return h.NumInputUnits, h.NumHiddenUnits
+}
+
+// Init initializes weights by init and biases to zero. If init is nil,
+// it performs a heuristic initialization instead: weights are drawn from
+// U(-0.5, 0.5) and biases are set to one. rng is the source of randomness.
+func (h *HiddenLayer) Init(init initializer.Initializer, rng *rand.Rand) {
+	if init != nil {
+		init.Init(h.W, h.NumInputUnits, h.NumHiddenUnits, rng)
+		for j := range h.B {
+			h.B[j] = 0.0
 		}
+		return
+	}
+
+	for i := range h.W.Data {
+		h.W.Data[i] = rng.Float64() - 0.5
 	}
 
 	for j := range h.B {
@@ -37,27 +174,27 @@ func (h *HiddenLayer) Init() {
 
 // Forward prop
 func (h *HiddenLayer) Forward(input []float64) []float64 {
-	return nnet.Forward(input, h.W, h.B)
+	predicted := h.W.MulVecTrans(input, nil)
+	for i := range predicted {
+		predicted[i] += h.B[i]
+	}
+	h.Activation.Forward(predicted)
+	return predicted
 }
 
-func (h *HiddenLayer) ForwardBatch(input [][]float64) [][]float64 {
+// ForwardBatch implements Layer.
+func (h *HiddenLayer) ForwardBatch(input [][]float64, training bool,
+	rng *rand.Rand) [][]float64 {
 	predicted := make([][]float64, len(input))
 	for i := range input {
-		predicted[i] = nnet.Forward(input[i], h.W, h.B)
+		predicted[i] = h.Forward(input[i])
 	}
+	h.input, h.output = input, predicted
 	return predicted
 }
 
 func (h *HiddenLayer) AccumulateDelta(deltas []float64) []float64 {
-	acc := make([]float64, h.NumInputUnits)
-	for i := range acc {
-		sum := 0.0
-		for j := 0; j < h.NumHiddenUnits; j++ {
-			sum += deltas[j] * h.W[i][j]
-		}
-		acc[i] = sum
-	}
-	return acc
+	return h.W.MulVec(deltas, nil)
 }
 
 func (h *HiddenLayer) AccumulateDeltaBatch(deltas [][]float64) [][]float64 {
@@ -68,49 +205,33 @@ func (h *HiddenLayer) AccumulateDeltaBatch(deltas [][]float64) [][]float64 {
 	return acc
 }
 
-func (h *HiddenLayer) BackwardWithTarget(predicted, target []float64) []float64 {
-	delta := make([]float64, h.NumHiddenUnits)
-	for i := 0; i < h.NumHiddenUnits; i++ {
-		delta[i] = (predicted[i] - target[i]) * nnet.DSigmoid(predicted[i])
+// Backward implements Layer.
+func (h *HiddenLayer) Backward(grad [][]float64) [][]float64 {
+	deltas := make([][]float64, len(grad))
+	for n := range grad {
+		deltas[n] = append([]float64(nil), grad[n]...)
+		h.Activation.Backward(h.output[n], deltas[n])
 	}
-	return delta
+	return h.backwardPreActivation(deltas)
 }
 
-func (h *HiddenLayer) Backward(predicted, accumulateDelta []float64) []float64 {
-	delta := make([]float64, h.NumHiddenUnits)
-	for i := 0; i < h.NumHiddenUnits; i++ {
-		delta[i] = accumulateDelta[i] * nnet.DSigmoid(predicted[i])
-	}
-	return delta
+func (h *HiddenLayer) outputActivation() nnet.Activation {
+	return h.Activation
 }
 
-func (h *HiddenLayer) BackwardWithTargetBatch(predicted, target [][]float64) ([][]float64, [][]float64) {
-	deltas := make([][]float64, len(predicted))
-	for i := range predicted {
-		deltas[i] = h.BackwardWithTarget(predicted[i], target[i])
-	}
-	return deltas, h.AccumulateDeltaBatch(deltas)
+func (h *HiddenLayer) backwardPreActivation(deltas [][]float64) [][]float64 {
+	h.computeGradient(h.input, deltas, h.numWorkers, -1.0)
+	return h.AccumulateDeltaBatch(deltas)
 }
 
-func (h *HiddenLayer) BackwardBatch(predicted, accumulateDelta [][]float64) ([][]float64, [][]float64) {
-	deltas := make([][]float64, len(predicted))
-
-	for i := range predicted {
-		deltas[i] = h.Backward(predicted[i], accumulateDelta[i])
-	}
-	return deltas, h.AccumulateDeltaBatch(deltas)
-}
-
-func (h *HiddenLayer) Gradient(input, deltas [][]float64) ([][]float64, []float64) {
-	gradW := nnet.MakeMatrix(len(h.W), len(h.W[0]))
+func (h *HiddenLayer) Gradient(input, deltas [][]float64) (*nnet.Matrix, []float64) {
+	gradW := nnet.NewMatrix(h.W.Rows, h.W.Cols)
 	gradB := make([]float64, len(h.B))
 
 	// Gradient
 	for n := range input {
+		gradW.AddOuter(-1.0, input[n], deltas[n])
 		for i := 0; i < h.NumHiddenUnits; i++ {
-			for j := 0; j < h.NumInputUnits; j++ {
-				gradW[j][i] -= deltas[n][i] * input[n][j]
-			}
 			gradB[i] -= deltas[n][i]
 		}
 	}
@@ -118,17 +239,49 @@ func (h *HiddenLayer) Gradient(input, deltas [][]float64) ([][]float64, []float6
 	return gradW, gradB
 }
 
-func (h *HiddenLayer) Turn(batch, deltas [][]float64, option TrainingOption) {
-	gradW, gradB := h.Gradient(batch, deltas)
+// ComputeGradient stores the gradients of the objective with respect to W
+// and B, averaged over the mini-batch, in GradW and GradB. The mini-batch is
+// split across numWorkers goroutines and the partial sums are reduced in a
+// fixed order, so that the result is reproducible for a given numWorkers.
+func (h *HiddenLayer) ComputeGradient(input, deltas [][]float64, numWorkers int) {
+	h.computeGradient(input, deltas, numWorkers, -1.0/float64(len(input)))
+}
 
-	// mini-batch SGD
-	for i := 0; i < h.NumHiddenUnits; i++ {
-		for j := 0; j < h.NumInputUnits; j++ {
-			h.W[j][i] += option.LearningRate * gradW[j][i] / float64(len(batch))
-			if option.L2Regularization {
-				h.W[j][i] *= (1.0 - option.RegularizationRate)
-			}
-		}
-		h.B[i] += option.LearningRate * gradB[i] / float64(len(batch))
+// computeGradient stores the sums of the gradients over the mini-batch
+// multiplied by scale, which is negative as Gradient returns descent
+// directions.
+func (h *HiddenLayer) computeGradient(input, deltas [][]float64,
+	numWorkers int, scale float64) {
+	numChunks := nnet.NumChunks(len(input), numWorkers)
+	gradWs := make([]*nnet.Matrix, numChunks)
+	gradBs := make([][]float64, numChunks)
+	nnet.ParallelFor(len(input), numWorkers, func(c, b, e int) {
+		gradWs[c], gradBs[c] = h.Gradient(input[b:e], deltas[b:e])
+	})
+
+	gradW, gradB := gradWs[0], gradBs[0]
+	for c := 1; c < numChunks; c++ {
+		gradW.AddScaled(1.0, gradWs[c])
+		nnet.Axpy(1.0, gradBs[c], gradB)
+	}
+
+	gradW.Scale(scale)
+	for i := range gradB {
+		gradB[i] *= scale
+	}
+	h.GradW, h.GradB = gradW, gradB
+}
+
+// Params returns the weight and bias of the layer together with their
+// gradients computed by the last call of Backward or ComputeGradient.
+func (h *HiddenLayer) Params() []*nnet.Param {
+	if h.GradW == nil {
+		h.GradW = nnet.NewMatrix(h.W.Rows, h.W.Cols)
+		h.GradB = make([]float64, len(h.B))
+	}
+	return []*nnet.Param{
+		{Name: "W", Value: h.W.Data, Grad: h.GradW.Data,
+			Rows: h.W.Rows, Cols: h.W.Cols},
+		{Name: "B", Value: h.B, Grad: h.GradB},
 	}
 }
@@ -0,0 +1,231 @@
+package mlp
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"github.com/r9y9/nnet"
+	"math/rand"
+	"sync"
+)
+
+// Layer is a layer of MLP. Layers transform mini-batches whose rows are
+// samples and learn by backpropagation.
+type Layer interface {
+	// Kind identifies the type of the layer in saved models. It must be
+	// registered by RegisterLayer for models with the layer to be loaded.
+	Kind() string
+
+	// Forward returns the output for input in inference. It must be safe
+	// for concurrent use.
+	Forward(input []float64) []float64
+
+	// ForwardBatch returns the outputs for a mini-batch and keeps what
+	// Backward needs. Layers may behave differently in training, e.g. draw
+	// from rng.
+	ForwardBatch(input [][]float64, training bool, rng *rand.Rand) [][]float64
+
+	// Backward takes the gradients of the objective with respect to the
+	// outputs of the last ForwardBatch, stores the gradients of the
+	// parameters and returns the gradients with respect to the inputs.
+	Backward(grad [][]float64) [][]float64
+
+	// Params returns views of the parameters together with their
+	// gradients computed by the last Backward.
+	Params() []*nnet.Param
+}
+
+// Sized is implemented by layers with fixed numbers of inputs and outputs,
+// which MLP checks against neighboring layers. Layers that don't implement
+// it are expected to keep the number of units.
+type Sized interface {
+	Size() (inputs, outputs int)
+}
+
+// checker is implemented by the layers of this package to check their
+// parameters. layer is the index used in errors.
+type checker interface {
+	check(layer int) error
+}
+
+// activationOutput is implemented by layers whose outputs are activations,
+// so that the gradients of an output layer with respect to the
+// pre-activations are computed by nnet.OutputDelta, which avoids dividing
+// by probabilities for softmax with cross-entropy.
+type activationOutput interface {
+	outputActivation() nnet.Activation
+	backwardPreActivation(deltas [][]float64) [][]float64
+}
+
+var (
+	layerRegistryMu sync.RWMutex
+	layerRegistry   = make(map[string]func() Layer)
+)
+
+// RegisterLayer makes a layer kind available to Load and nnet.LoadModel.
+// newLayer must return an empty layer to decode into, which is done by
+// UnmarshalBinary in binary payloads if the layer implements
+// encoding.BinaryUnmarshaler and by encoding/json otherwise.
+func RegisterLayer(kind string, newLayer func() Layer) {
+	layerRegistryMu.Lock()
+	defer layerRegistryMu.Unlock()
+	if _, dup := layerRegistry[kind]; dup {
+		panic("mlp: RegisterLayer called twice for kind " + kind)
+	}
+	layerRegistry[kind] = newLayer
+}
+
+func init() {
+	RegisterLayer("dense", func() Layer { return &HiddenLayer{} })
+	RegisterLayer("activation", func() Layer { return &ActivationLayer{} })
+	RegisterLayer("dropout", func() Layer { return &Dropout{} })
+	RegisterLayer("batch_norm", func() Layer { return &BatchNorm{} })
+}
+
+func newLayer(kind string) (Layer, error) {
+	layerRegistryMu.RLock()
+	newLayer, ok := layerRegistry[kind]
+	layerRegistryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("mlp: unknown layer kind %q", kind)
+	}
+	return newLayer(), nil
+}
+
+// taggedLayer is the json encoding of a layer.
+type taggedLayer struct {
+	Kind  string
+	Layer json.RawMessage
+}
+
+func marshalLayer(layer Layer) (taggedLayer, error) {
+	b, err := json.Marshal(layer)
+	return taggedLayer{Kind: layer.Kind(), Layer: b}, err
+}
+
+func unmarshalLayer(t taggedLayer) (Layer, error) {
+	layer, err := newLayer(t.Kind)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(t.Layer, layer); err != nil {
+		return nil, err
+	}
+	return layer, nil
+}
+
+// encodeLayer writes the kind of layer followed by its payload.
+func encodeLayer(e *nnet.BinaryEncoder, layer Layer) error {
+	var b []byte
+	var err error
+	if m, ok := layer.(encoding.BinaryMarshaler); ok {
+		b, err = m.MarshalBinary()
+	} else {
+		b, err = json.Marshal(layer)
+	}
+	if err != nil {
+		return err
+	}
+	e.String(layer.Kind())
+	e.String(string(b))
+	return nil
+}
+
+func decodeLayer(dec *nnet.BinaryDecoder) (Layer, error) {
+	kind, b := dec.String(), []byte(dec.String())
+	if dec.Err() != nil {
+		return nil, dec.Err()
+	}
+	layer, err := newLayer(kind)
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := layer.(encoding.BinaryUnmarshaler); ok {
+		err = u.UnmarshalBinary(b)
+	} else {
+		err = json.Unmarshal(b, layer)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return layer, nil
+}
+
+// ActivationLayer applies an activation to its inputs. Its kind is
+// "activation".
+type ActivationLayer struct {
+	Activation nnet.Activation
+
+	output [][]float64 // of the last ForwardBatch
+}
+
+// Kind implements Layer.
+func (a *ActivationLayer) Kind() string {
+	return "activation"
+}
+
+func (a *ActivationLayer) check(layer int) error {
+	if a.Activation == nil {
+		return fmt.Errorf("mlp: layer %d has no activation", layer)
+	}
+	return nil
+}
+
+// Forward implements Layer.
+func (a *ActivationLayer) Forward(input []float64) []float64 {
+	output := append([]float64(nil), input...)
+	a.Activation.Forward(output)
+	return output
+}
+
+// ForwardBatch implements Layer.
+func (a *ActivationLayer) ForwardBatch(input [][]float64, training bool,
+	rng *rand.Rand) [][]float64 {
+	a.output = make([][]float64, len(input))
+	for n := range input {
+		a.output[n] = a.Forward(input[n])
+	}
+	return a.output
+}
+
+// Backward implements Layer.
+func (a *ActivationLayer) Backward(grad [][]float64) [][]float64 {
+	result := make([][]float64, len(grad))
+	for n := range grad {
+		result[n] = append([]float64(nil), grad[n]...)
+		a.Activation.Backward(a.output[n], result[n])
+	}
+	return result
+}
+
+func (a *ActivationLayer) outputActivation() nnet.Activation {
+	return a.Activation
+}
+
+func (a *ActivationLayer) backwardPreActivation(deltas [][]float64) [][]float64 {
+	return deltas
+}
+
+// Params implements Layer. Activations have no parameters.
+func (a *ActivationLayer) Params() []*nnet.Param {
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. The activation is saved by name.
+func (a *ActivationLayer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct{ Activation string }{a.Activation.Name()})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *ActivationLayer) UnmarshalJSON(b []byte) error {
+	var aux struct{ Activation string }
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	activation, err := nnet.NewActivation(aux.Activation)
+	if err != nil {
+		return err
+	}
+	a.Activation = activation
+	return nil
+}
@@ -1,56 +1,266 @@
 package mlp
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/r9y9/nnet"
-	"os"
+	"math/rand"
 )
 
 // MLP represents multi layer perceptron (Feed Forward Neural Networks).
+// Layers may be of any type implementing Layer, e.g. dense layers with
+// HiddenLayer, dropout and batch normalization.
 type MLP struct {
-	HiddenLayers []*HiddenLayer
-	Option       TrainingOption
-	NumLayers    int // proxy for len(HiddenLayers)
+	Layers    []Layer
+	Option    TrainingOption
+	NumLayers int // proxy for len(Layers)
+	rng       *rand.Rand
+	training  bool
+	norms     nnet.GradNorms // of the last update
 }
 
 type TrainingOption struct {
 	LearningRate       float64
 	Epoches            int
 	MiniBatchSize      int
-	L2Regularization   bool
+	Shuffle            bool  // visits data in a different order every epoch
+	Seed               int64 // seed of the order of shuffled data
+	DropRemainder      bool  // skips the last mini-batch if it is smaller
+	L2Regularization   bool  // Deprecated: use Regularization
 	RegularizationRate float64
+	Regularization     *nnet.Regularization // per layer, see nnet.Regularization
 	Monitoring         bool
+	NumWorkers         int             // goroutines that share a mini-batch
+	ClipNorm           float64         // maximum L2 norm of all gradients, 0 disables
+	ClipValue          float64         // maximum absolute value of gradients, 0 disables
+	Loss               nnet.Loss       `json:"-"` // see loss for the default
+	Optimizer          nnet.Optimizer  `json:"-"` // SGD with LearningRate if nil
+	Schedule           nnet.Schedule   `json:"-"` // constant LearningRate if nil
+	Callbacks          []nnet.Callback `json:"-"`
+	ValidationInput    [][]float64     `json:"-"`
+	ValidationTarget   [][]float64     `json:"-"`
+	ValidationMetric   nnet.Metric     `json:"-"` // SupervisedObjective if nil
+	Patience           int             // epochs without improvement before stopping
+	Checkpoint         string          // file to write checkpoints to, see Resume
+	CheckpointEvery    int             // epochs between checkpoints
 }
 
-// NewMLP create a new MLP instance.
-func NewMLP() *MLP {
+// NewMLP create a new MLP instance. rng is used to initialize layers added
+// by AddLayer. If rng is nil, a generator seeded by the current time is
+// used.
+func NewMLP(rng *rand.Rand) *MLP {
 	d := new(MLP)
+	d.rng = nnet.DefaultRand(rng)
 	return d
 }
 
-// AddLayer adds a new hidden layer.
-func (d *MLP) AddLayer(numInputUnits, numHiddenUnits int) {
-	layer := NewHiddenLayer(numInputUnits, numHiddenUnits)
-	d.HiddenLayers = append(d.HiddenLayers, layer)
+// AddLayer adds a new hidden layer with sigmoid activation. It returns a
+// *nnet.ShapeError if numInputUnits differs from the output of the last
+// layer.
+func (d *MLP) AddLayer(numInputUnits, numHiddenUnits int) error {
+	return d.AddLayerWithActivation(numInputUnits, numHiddenUnits,
+		nnet.SigmoidActivation{})
+}
+
+// AddLayerWithActivation adds a new hidden layer with the given activation.
+func (d *MLP) AddLayerWithActivation(numInputUnits, numHiddenUnits int,
+	activation nnet.Activation) error {
+	if err := d.checkNext(numInputUnits); err != nil {
+		return err
+	}
+	return d.AddHiddenLayer(NewHiddenLayer(numInputUnits, numHiddenUnits,
+		activation, nil, d.Rand()))
+}
+
+// AddSoftmaxLayer adds an output layer whose outputs are the probabilities
+// of numClasses classes. Unless another loss is given in the training
+// options, the network is trained with cross-entropy against targets that
+// are distributions over classes, e.g. one-hot vectors.
+func (d *MLP) AddSoftmaxLayer(numInputUnits, numClasses int) error {
+	return d.AddLayerWithActivation(numInputUnits, numClasses, nnet.Softmax{})
+}
+
+// AddBatchNormLayer adds a dense layer whose pre-activations are
+// normalized by batch normalization, which helps deep networks to train.
+// The layer consists of a HiddenLayer with linear activation, a BatchNorm
+// and an ActivationLayer. If activation is nil, sigmoid is used.
+func (d *MLP) AddBatchNormLayer(numInputUnits, numHiddenUnits int,
+	activation nnet.Activation) error {
+	if err := d.checkNext(numInputUnits); err != nil {
+		return err
+	}
+	if activation == nil {
+		activation = nnet.SigmoidActivation{}
+	}
+	d.Add(NewHiddenLayer(numInputUnits, numHiddenUnits, nnet.Linear{}, nil,
+		d.Rand()))
+	d.Add(NewBatchNorm(numHiddenUnits))
+	return d.Add(&ActivationLayer{Activation: activation})
+}
+
+// AddHiddenLayer adds a layer created by NewHiddenLayer. It returns a
+// *nnet.ShapeError if the layer doesn't fit the last layer.
+func (d *MLP) AddHiddenLayer(layer *HiddenLayer) error {
+	return d.Add(layer)
+}
+
+// Add adds a layer of any type. It returns an error if the layer doesn't
+// fit the last layer or its parameters are inconsistent.
+func (d *MLP) Add(layer Layer) error {
+	if s, ok := layer.(Sized); ok {
+		inputs, _ := s.Size()
+		if err := d.checkNext(inputs); err != nil {
+			return err
+		}
+	}
+	if err := checkLayer(layer, len(d.Layers)); err != nil {
+		return err
+	}
+	d.Layers = append(d.Layers, layer)
 	d.NumLayers++
+	return nil
 }
 
-// Load loads MLP from a dump file and return its instatnce.
-func Load(filename string) (*MLP, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+// checkNext checks the number of input units of a layer added next.
+func (d *MLP) checkNext(numInputUnits int) error {
+	outputs, ok := d.outputSize()
+	if !ok {
+		return nil
 	}
-	defer file.Close()
+	return nnet.CheckSize(fmt.Sprintf("layer %d input units", len(d.Layers)),
+		outputs, numInputUnits)
+}
 
-	decoder := json.NewDecoder(file)
-	d := &MLP{}
-	err = decoder.Decode(d)
+// inputSize returns the number of inputs of the first sized layer.
+func (d *MLP) inputSize() (int, bool) {
+	for _, layer := range d.Layers {
+		if s, ok := layer.(Sized); ok {
+			inputs, _ := s.Size()
+			return inputs, true
+		}
+	}
+	return 0, false
+}
 
-	if err != nil {
-		return nil, err
+// outputSize returns the number of outputs of the last sized layer.
+func (d *MLP) outputSize() (int, bool) {
+	for i := len(d.Layers) - 1; i >= 0; i-- {
+		if s, ok := d.Layers[i].(Sized); ok {
+			_, outputs := s.Size()
+			return outputs, true
+		}
 	}
+	return 0, false
+}
 
+// checkLayer checks the parameters of layers of this package and of layers
+// implementing nnet.Validator.
+func checkLayer(layer Layer, index int) error {
+	switch l := layer.(type) {
+	case checker:
+		return l.check(index)
+	case nnet.Validator:
+		if err := l.Validate(); err != nil {
+			return fmt.Errorf("mlp: layer %d: %w", index, err)
+		}
+	}
+	return nil
+}
+
+var errNoLayers = errors.New("mlp: no layers")
+
+// Validate implements nnet.Validator. It checks the parameters of all
+// layers and that adjacent sized layers fit.
+func (d *MLP) Validate() error {
+	outputs := -1
+	for i, layer := range d.Layers {
+		if err := checkLayer(layer, i); err != nil {
+			return err
+		}
+		s, ok := layer.(Sized)
+		if !ok {
+			continue
+		}
+		inputs, next := s.Size()
+		if outputs >= 0 {
+			err := nnet.CheckSize(fmt.Sprintf("layer %d input units", i),
+				outputs, inputs)
+			if err != nil {
+				return err
+			}
+		}
+		outputs = next
+	}
+	return nil
+}
+
+// ValidateShape implements nnet.ShapeValidator. target may be nil.
+func (d *MLP) ValidateShape(input, target [][]float64) error {
+	if len(d.Layers) == 0 {
+		return errNoLayers
+	}
+	if inputs, ok := d.inputSize(); ok {
+		if err := nnet.CheckRows("input", input, inputs); err != nil {
+			return err
+		}
+	}
+	if outputs, ok := d.outputSize(); ok {
+		return nnet.CheckRows("target", target, outputs)
+	}
+	return nil
+}
+
+// Predict is like Forward but returns an error instead of panicking if
+// input doesn't match the network.
+func (d *MLP) Predict(input []float64) ([]float64, error) {
+	if len(d.Layers) == 0 {
+		return nil, errNoLayers
+	}
+	if inputs, ok := d.inputSize(); ok {
+		if err := nnet.CheckSize("input", inputs, len(input)); err != nil {
+			return nil, err
+		}
+	}
+	return d.Forward(input), nil
+}
+
+// SetTraining switches between training and inference mode. In training
+// mode, ComputeGradient drops units at random and normalizes layers by the
+// statistics of the mini-batch. SupervisedMiniBatchUpdate, and so Train and
+// nnet.Trainer, always update in training mode, whereas Forward is
+// deterministic in both modes.
+func (d *MLP) SetTraining(training bool) {
+	d.training = training
+}
+
+// Training reports whether the MLP is in training mode.
+func (d *MLP) Training() bool {
+	return d.training
+}
+
+// Rand returns the random number generator of MLP. Models loaded from
+// dump files get a generator seeded by the current time.
+func (d *MLP) Rand() *rand.Rand {
+	if d.rng == nil {
+		d.rng = nnet.DefaultRand(nil)
+	}
+	return d.rng
+}
+
+// SetRand sets the random number generator used to initialize layers.
+func (d *MLP) SetRand(rng *rand.Rand) {
+	d.rng = rng
+}
+
+// Load loads MLP from a dump file and return its instatnce.
+func Load(filename string) (*MLP, error) {
+	d := &MLP{}
+	if err := nnet.LoadFile(filename, d); err != nil {
+		return nil, err
+	}
 	return d, nil
 }
 
@@ -58,22 +268,147 @@ func (d *MLP) Dump(filename string) error {
 	return nnet.DumpAsJson(filename, d)
 }
 
-func (d *MLP) Forward(input []float64) []float64 {
-	// Start with first layer
-	predicted := d.HiddenLayers[0].Forward(input)
+func init() {
+	nnet.RegisterModel("mlp", func() nnet.Model { return &MLP{} })
+}
+
+// Kind implements nnet.Model.
+func (d *MLP) Kind() string {
+	return "mlp"
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. Only the layers are
+// encoded; training options are not.
+func (d *MLP) MarshalBinary() ([]byte, error) {
+	var e nnet.BinaryEncoder
+	e.Int(len(d.Layers))
+	for _, layer := range d.Layers {
+		if err := encodeLayer(&e, layer); err != nil {
+			return nil, err
+		}
+	}
+	return e.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (d *MLP) UnmarshalBinary(b []byte) error {
+	dec := nnet.NewBinaryDecoder(b)
+	numLayers := dec.Int()
+	var layers []Layer
+	for i := 0; i < numLayers && dec.Err() == nil; i++ {
+		layer, err := decodeLayer(dec)
+		if err != nil {
+			return fmt.Errorf("mlp: layer %d: %w", i, err)
+		}
+		layers = append(layers, layer)
+	}
+	if err := dec.Finish(); err != nil {
+		return err
+	}
+	d.Layers, d.NumLayers = layers, len(layers)
+	return nil
+}
+
+// mlpJSON is the json encoding of MLP. Dumps of the first version have
+// HiddenLayers instead of Layers.
+type mlpJSON struct {
+	Layers       []taggedLayer
+	HiddenLayers []baselineLayer `json:",omitempty"`
+	Option       TrainingOption
+	NumLayers    int
+}
+
+// baselineLayer is a layer in dumps of the first version, which only had
+// dense layers with sigmoid activation.
+type baselineLayer struct {
+	W              *nnet.Matrix
+	B              []float64
+	NumInputUnits  int
+	NumHiddenUnits int
+}
+
+// MarshalJSON implements json.Marshaler. Layers are saved with their kinds.
+func (d *MLP) MarshalJSON() ([]byte, error) {
+	aux := mlpJSON{Option: d.Option, NumLayers: d.NumLayers}
+	for _, layer := range d.Layers {
+		t, err := marshalLayer(layer)
+		if err != nil {
+			return nil, err
+		}
+		aux.Layers = append(aux.Layers, t)
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Unknown fields are rejected,
+// so that a dump of another type of model is not loaded silently.
+func (d *MLP) UnmarshalJSON(b []byte) error {
+	var aux mlpJSON
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&aux); err != nil {
+		return err
+	}
 
-	// Trasfer to next layer
-	for j := 1; j < len(d.HiddenLayers); j++ {
-		predicted = d.HiddenLayers[j].Forward(predicted)
+	var layers []Layer
+	for i, t := range aux.Layers {
+		layer, err := unmarshalLayer(t)
+		if err != nil {
+			return fmt.Errorf("mlp: layer %d: %w", i, err)
+		}
+		layers = append(layers, layer)
 	}
+	for _, l := range aux.HiddenLayers {
+		layers = append(layers, &HiddenLayer{
+			W:              l.W,
+			B:              l.B,
+			NumInputUnits:  l.NumInputUnits,
+			NumHiddenUnits: l.NumHiddenUnits,
+			Activation:     nnet.SigmoidActivation{},
+		})
+	}
+	d.Layers, d.Option, d.NumLayers = layers, aux.Option, len(layers)
+	return nil
+}
 
+func (d *MLP) Forward(input []float64) []float64 {
+	predicted := input
+	for _, layer := range d.Layers {
+		predicted = layer.Forward(predicted)
+	}
 	return predicted
 }
 
-// ObjectiveFunction returns the objective function to optimize,
-//  given a input dat and its supervised data.
+// ForwardBatch performs Forward for all inputs concurrently.
+func (d *MLP) ForwardBatch(input [][]float64) [][]float64 {
+	return nnet.ForwardBatch(d, input)
+}
+
+// SupervisedObjective returns the average loss over the given input data
+// and its supervised data.
 func (d *MLP) SupervisedObjective(input, target [][]float64) float64 {
-	return d.MeanSquareErr(input, target)
+	loss := d.loss()
+	sum := 0.0
+	for i := range input {
+		sum += loss.Value(d.Forward(input[i]), target[i])
+	}
+	return sum / float64(len(input))
+}
+
+// loss returns the loss function to optimize. If Option.Loss is nil, it is
+// CrossEntropy for a softmax output layer and MeanSquaredError otherwise.
+func (d *MLP) loss() nnet.Loss {
+	if d.Option.Loss != nil {
+		return d.Option.Loss
+	}
+	if n := len(d.Layers); n > 0 {
+		if a, ok := d.Layers[n-1].(activationOutput); ok {
+			if _, ok := a.outputActivation().(nnet.Softmax); ok {
+				return nnet.CrossEntropy{}
+			}
+		}
+	}
+	return nnet.MeanSquaredError{}
 }
 
 func (d *MLP) MeanSquareErr(input, target [][]float64) float64 {
@@ -84,44 +419,222 @@ func (d *MLP) MeanSquareErr(input, target [][]float64) float64 {
 	return 0.5 * sum / float64(len(target))
 }
 
-// MiniBatchSGDUpdate performs one backkpropagation proccedure.
+// MiniBatchSGDUpdate performs one backkpropagation proccedure. It runs in
+// training mode and restores the previous mode.
 func (d *MLP) SupervisedMiniBatchUpdate(input [][]float64, target [][]float64) {
-	predicted := make([][][]float64, len(d.HiddenLayers))
-	lastIndex := len(d.HiddenLayers) - 1
+	defer d.SetTraining(d.training)
+	d.training = true
+	d.ComputeGradient(input, target)
+	d.update()
+}
 
+// ComputeGradient computes the gradients of SupervisedObjective for the
+// mini-batch by backpropagation and stores them in the layers without
+// updating parameters.
+func (d *MLP) ComputeGradient(input [][]float64, target [][]float64) {
 	// 1. Forward
-	firstLayer := d.HiddenLayers[0]
-	predicted[0] = firstLayer.ForwardBatch(input)
-	for i := 1; i < len(d.HiddenLayers); i++ {
-		predicted[i] = d.HiddenLayers[i].ForwardBatch(predicted[i-1])
+	for _, layer := range d.Layers {
+		if h, ok := layer.(*HiddenLayer); ok {
+			h.numWorkers = d.Option.NumWorkers
+		}
+		input = layer.ForwardBatch(input, d.training, d.Rand())
 	}
 
-	lastLayer := d.HiddenLayers[lastIndex]
-	lastPredicted := predicted[lastIndex]
+	// 2. Gradients of the average loss with respect to the outputs, or to
+	// the pre-activations if the output layer has an activation
+	loss := d.loss()
+	scale := 1.0 / float64(len(input))
+	grad := make([][]float64, len(input))
+	last := d.Layers[len(d.Layers)-1]
+	a, activation := last.(activationOutput)
+	for n := range input {
+		if activation {
+			grad[n] = nnet.OutputDelta(a.outputActivation(), loss, input[n],
+				target[n])
+		} else {
+			grad[n] = loss.Gradient(input[n], target[n])
+		}
+		for i := range grad[n] {
+			grad[n][i] *= scale
+		}
+	}
 
-	// 2. Backward
-	deltas := make([][][]float64, len(d.HiddenLayers))
-	sumDelta := make([][]float64, lastLayer.NumHiddenUnits)
-	deltas[lastIndex], sumDelta = lastLayer.BackwardWithTargetBatch(lastPredicted, target)
-	for i := lastIndex - 1; i >= 0; i-- {
-		deltas[i], sumDelta = d.HiddenLayers[i].BackwardBatch(predicted[i], sumDelta)
+	// 3. Backward
+	if activation {
+		grad = a.backwardPreActivation(grad)
+	} else {
+		grad = last.Backward(grad)
 	}
+	for i := len(d.Layers) - 2; i >= 0; i-- {
+		grad = d.Layers[i].Backward(grad)
+	}
+}
 
-	// 3. Feedback (update weight)
-	for i := len(d.HiddenLayers) - 1; i >= 1; i-- {
-		d.HiddenLayers[i].Turn(predicted[i-1], deltas[i], d.Option)
+// Params returns the parameters of all layers together with their
+// gradients. Parameters are named after the index of the layer.
+func (d *MLP) Params() []*nnet.Param {
+	var params []*nnet.Param
+	for i, layer := range d.Layers {
+		for _, p := range layer.Params() {
+			p.Name = fmt.Sprintf("layer%d.%s", i, p.Name)
+			params = append(params, p)
+		}
 	}
-	firstLayer.Turn(input, deltas[0], d.Option)
+	return params
+}
+
+// GradNorms returns the norms of the gradients of the last update before
+// clipping, see nnet.GradNorms.
+func (d *MLP) GradNorms() nnet.Metrics {
+	return d.norms.Metrics()
+}
+
+// update applies the optimizer to all parameters.
+func (d *MLP) update() {
+	params := d.Params()
+	d.norms.Clip(params, d.Option.ClipNorm, d.Option.ClipValue)
+	d.Option.Regularization.AddGradients(params)
+	optimizer := d.optimizer()
+	for _, p := range params {
+		optimizer.Update(p)
+	}
+	d.Option.Regularization.Constrain(params, optimizer.LearningRate())
+
+	// Shrinks weights regardless of the learning rate
+	if d.Option.L2Regularization {
+		for _, layer := range d.Layers {
+			if h, ok := layer.(*HiddenLayer); ok {
+				h.W.Scale(1.0 - d.Option.RegularizationRate)
+			}
+		}
+	}
+}
+
+// LearningRate returns the learning rate of the optimizer.
+func (d *MLP) LearningRate() float64 {
+	return d.optimizer().LearningRate()
+}
+
+// SetLearningRate sets the learning rate of the optimizer.
+func (d *MLP) SetLearningRate(rate float64) {
+	d.optimizer().SetLearningRate(rate)
+}
+
+// optimizer returns the optimizer used in training. It defaults to SGD.
+func (d *MLP) optimizer() nnet.Optimizer {
+	if d.Option.Optimizer == nil {
+		d.Option.Optimizer = nnet.NewSGD(d.Option.LearningRate)
+	}
+	return d.Option.Optimizer
 }
 
 // Train performs mini-batch SGD-based backpropagation to optimize network.
 func (d *MLP) Train(input [][]float64, target [][]float64, option TrainingOption) error {
+	return d.TrainContext(context.Background(), input, target, option)
+}
+
+// TrainContext is like Train but stops at the next mini-batch boundary when
+// ctx is done and returns ctx.Err(). The model is left as it was after the
+// last mini-batch update.
+func (d *MLP) TrainContext(ctx context.Context, input [][]float64,
+	target [][]float64, option TrainingOption) error {
 	d.Option = option
+	return d.trainer().SupervisedMiniBatchTrainContext(ctx, d, input, target)
+}
+
+// TrainDataset is like Train but reads mini-batches from data, which need
+// not fit in memory.
+func (d *MLP) TrainDataset(data nnet.Dataset, option TrainingOption) error {
+	return d.TrainDatasetContext(context.Background(), data, option)
+}
+
+// TrainDatasetContext is like TrainDataset but stops at the next mini-batch
+// boundary when ctx is done and returns ctx.Err().
+func (d *MLP) TrainDatasetContext(ctx context.Context, data nnet.Dataset,
+	option TrainingOption) error {
+	d.Option = option
+	return d.trainer().SupervisedMiniBatchTrainDatasetContext(ctx, d, data)
+}
+
+// Resume continues training from a checkpoint written by Train with
+// option.Checkpoint. input, target and option must be the same as in the
+// original run, except for options that don't affect training such as
+// Callbacks and Epoches.
+func (d *MLP) Resume(filename string, input [][]float64, target [][]float64,
+	option TrainingOption) error {
+	return d.ResumeContext(context.Background(), filename, input, target,
+		option)
+}
+
+// ResumeContext is like Resume but stops at the next mini-batch boundary
+// when ctx is done and returns ctx.Err().
+func (d *MLP) ResumeContext(ctx context.Context, filename string,
+	input [][]float64, target [][]float64, option TrainingOption) error {
+	d.Option = option
+	s := d.trainer()
+	if err := s.Resume(filename, d); err != nil {
+		return err
+	}
+	return s.SupervisedMiniBatchTrainContext(ctx, d, input, target)
+}
+
+// trainer returns a trainer for the current options.
+func (d *MLP) trainer() *nnet.Trainer {
 	opt := nnet.BaseTrainingOption{
 		Epoches:       d.Option.Epoches,
 		MiniBatchSize: d.Option.MiniBatchSize,
+		Shuffle:       d.Option.Shuffle,
+		Seed:          d.Option.Seed,
+		DropRemainder: d.Option.DropRemainder,
 		Monitoring:    d.Option.Monitoring,
+		Schedule:      d.Option.Schedule,
+		Callbacks:     d.Option.Callbacks,
+
+		ValidationInput:  d.Option.ValidationInput,
+		ValidationTarget: d.Option.ValidationTarget,
+		ValidationMetric: d.Option.ValidationMetric,
+		Patience:         d.Option.Patience,
+
+		Checkpoint:      d.Option.Checkpoint,
+		CheckpointEvery: d.Option.CheckpointEvery,
 	}
-	s := nnet.NewTrainer(opt)
-	return s.SupervisedMiniBatchTrain(d, input, target)
+	return nnet.NewTrainer(opt)
+}
+
+// checkpoint is the training state of MLP.
+type checkpoint struct {
+	MLP       *MLP
+	Optimizer json.RawMessage
+	Seed      int64
+}
+
+// Checkpoint implements nnet.Checkpointer.
+func (d *MLP) Checkpoint() ([]byte, error) {
+	optimizer, err := nnet.MarshalOptimizer(d.optimizer())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(checkpoint{
+		MLP:       d,
+		Optimizer: optimizer,
+		Seed:      nnet.ReseedRand(d.Rand()),
+	})
+}
+
+// RestoreCheckpoint implements nnet.Checkpointer. The optimizer is restored
+// from the checkpoint, while the other options are kept.
+func (d *MLP) RestoreCheckpoint(b []byte) error {
+	option := d.Option
+	c := checkpoint{MLP: d}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return err
+	}
+	optimizer, err := nnet.UnmarshalOptimizer(c.Optimizer)
+	if err != nil {
+		return err
+	}
+	option.Optimizer = optimizer
+	d.Option = option
+	d.rng = nnet.NewRand(c.Seed)
+	return nil
 }
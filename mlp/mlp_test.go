@@ -1,7 +1,14 @@
 package mlp
 
 import (
+	"encoding/json"
+	"errors"
+	"github.com/r9y9/nnet"
+	"github.com/r9y9/nnet/gradcheck"
 	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -10,7 +17,7 @@ func TestMLP(t *testing.T) {
 	input := [][]float64{{0, 0}, {0, 1}, {1, 0}, {1, 1}}
 	target := [][]float64{{0}, {1}, {1}, {0}}
 
-	d := NewMLP()
+	d := NewMLP(nil)
 	d.AddLayer(2, 10)
 	d.AddLayer(10, 10)
 	d.AddLayer(10, 1)
@@ -42,7 +49,7 @@ func BenchmarkMLP(b *testing.B) {
 	input := [][]float64{{0, 0}, {0, 1}, {1, 0}, {1, 1}}
 	target := [][]float64{{0}, {1}, {1}, {0}}
 
-	d := NewMLP()
+	d := NewMLP(nil)
 	d.AddLayer(2, 10)
 	d.AddLayer(10, 10)
 	d.AddLayer(10, 1)
@@ -59,3 +66,682 @@ func BenchmarkMLP(b *testing.B) {
 		d.Train(input, target, option)
 	}
 }
+
+func TestMLPDumpAndLoad(t *testing.T) {
+	d := NewMLP(nil)
+	d.AddLayerWithActivation(2, 3, nnet.TanhActivation{})
+	d.AddLayerWithActivation(3, 2, nnet.Softmax{})
+
+	filename := filepath.Join(t.TempDir(), "mlp.json")
+	if err := d.Dump(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := loaded.Layers[0].(*HiddenLayer)
+	if _, ok := first.Activation.(nnet.TanhActivation); !ok {
+		t.Errorf("Activation of first layer is %v, want tanh.",
+			first.Activation)
+	}
+	input := []float64{0.5, -0.5}
+	expected, actual := d.Forward(input), loaded.Forward(input)
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Errorf("Loaded MLP returns %v, want %v.", actual, expected)
+			break
+		}
+	}
+}
+
+func TestComputeGradientWorkers(t *testing.T) {
+	rng := nnet.NewRand(1)
+	layer := NewHiddenLayer(3, 2, nil, nil, rng)
+	input := make([][]float64, 10)
+	deltas := make([][]float64, 10)
+	for n := range input {
+		input[n] = []float64{rng.Float64(), rng.Float64(), rng.Float64()}
+		deltas[n] = []float64{rng.NormFloat64(), rng.NormFloat64()}
+	}
+
+	layer.ComputeGradient(input, deltas, 1)
+	gradW, gradB := layer.GradW.Clone(), append([]float64(nil), layer.GradB...)
+	layer.ComputeGradient(input, deltas, 4)
+
+	for i := range gradW.Data {
+		if math.Abs(gradW.Data[i]-layer.GradW.Data[i]) > 1.0e-12 {
+			t.Errorf("GradW with 4 workers is %v, want %v.",
+				layer.GradW.Data[i], gradW.Data[i])
+		}
+	}
+	for i := range gradB {
+		if math.Abs(gradB[i]-layer.GradB[i]) > 1.0e-12 {
+			t.Errorf("GradB with 4 workers is %v, want %v.",
+				layer.GradB[i], gradB[i])
+		}
+	}
+}
+
+func TestMLPGradient(t *testing.T) {
+	rng := nnet.NewRand(1)
+	input := make([][]float64, 5)
+	target := make([][]float64, 5)
+	for n := range input {
+		input[n] = []float64{rng.NormFloat64(), rng.NormFloat64(),
+			rng.NormFloat64()}
+		target[n] = []float64{rng.Float64(), rng.Float64()}
+	}
+
+	for _, loss := range []nnet.Loss{nnet.MeanSquaredError{},
+		nnet.BinaryCrossEntropy{}} {
+		d := NewMLP(rng)
+		d.AddLayerWithActivation(3, 4, nnet.TanhActivation{})
+		d.AddLayer(4, 4)
+		d.AddLayer(4, 2)
+		d.Option.Loss = loss
+		for _, r := range gradcheck.Check(d, input, target, 0) {
+			if r.RelativeError > 1.0e-6 {
+				t.Errorf("Gradient with %s loss: %v", loss.Name(), r)
+			}
+		}
+	}
+}
+
+func TestMLPTrainDataset(t *testing.T) {
+	input := [][]float64{{0, 0}, {0, 1}, {1, 0}, {1, 1}}
+	target := [][]float64{{0}, {1}, {1}, {0}}
+	option := TrainingOption{LearningRate: 0.1, Epoches: 10, MiniBatchSize: 3,
+		Shuffle: true}
+
+	var nets [2]*MLP
+	for i := range nets {
+		nets[i] = NewMLP(nnet.NewRand(1))
+		nets[i].AddLayer(2, 3)
+		nets[i].AddLayer(3, 1)
+	}
+	if err := nets[0].Train(input, target, option); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := nnet.NewInMemory(input, target)
+	if err := nets[1].TrainDataset(data, option); err != nil {
+		t.Fatal(err)
+	}
+	params := nets[1].Params()
+	for i, p := range nets[0].Params() {
+		for j, w := range p.Value {
+			if params[i].Value[j] != w {
+				t.Fatalf("Weights trained on a dataset differ from in-memory data.")
+			}
+		}
+	}
+}
+
+func TestMLPSoftmaxGradient(t *testing.T) {
+	rng := nnet.NewRand(1)
+	input := make([][]float64, 5)
+	target := make([][]float64, 5)
+	for n := range input {
+		input[n] = []float64{rng.NormFloat64(), rng.NormFloat64()}
+		target[n] = make([]float64, 3)
+		target[n][rng.Intn(3)] = 1
+	}
+
+	d := NewMLP(rng)
+	d.AddLayer(2, 4)
+	d.AddSoftmaxLayer(4, 3)
+	for _, r := range gradcheck.Check(d, input, target, 0) {
+		if r.RelativeError > 1.0e-6 {
+			t.Errorf("Gradient: %v", r)
+		}
+	}
+}
+
+func TestMLPSoftmaxClassification(t *testing.T) {
+	rng := nnet.NewRand(1)
+	centers := [][]float64{{-2, 0}, {2, 0}, {0, 2}}
+	var input, target [][]float64
+	var labels []int
+	for n := 0; n < 150; n++ {
+		c := n % len(centers)
+		input = append(input, []float64{centers[c][0] + 0.5*rng.NormFloat64(),
+			centers[c][1] + 0.5*rng.NormFloat64()})
+		y := make([]float64, len(centers))
+		y[c] = 1
+		target = append(target, y)
+		labels = append(labels, c)
+	}
+
+	d := NewMLP(rng)
+	d.AddLayerWithActivation(2, 8, nnet.TanhActivation{})
+	d.AddSoftmaxLayer(8, 3)
+	option := TrainingOption{LearningRate: 0.1, Epoches: 20, MiniBatchSize: 10}
+	if err := d.Train(input, target, option); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := 0.0
+	for _, p := range d.Forward(input[0]) {
+		sum += p
+	}
+	if math.Abs(sum-1) > 1.0e-12 {
+		t.Errorf("Outputs sum to %v, want 1.", sum)
+	}
+	correct := 0
+	for i, label := range nnet.Test(d, input) {
+		if label == labels[i] {
+			correct++
+		}
+	}
+	if correct < 140 {
+		t.Errorf("%d of 150 samples are classified correctly, want 140.",
+			correct)
+	}
+}
+
+func TestMLPClipNorm(t *testing.T) {
+	d := NewMLP(nnet.NewRand(1))
+	d.AddLayer(2, 10)
+	d.AddLayer(10, 1)
+	d.Option = TrainingOption{LearningRate: 0.1, ClipNorm: 1.0e-3}
+	d.SupervisedMiniBatchUpdate([][]float64{{0, 1}, {1, 1}},
+		[][]float64{{1}, {0}})
+	if norm := nnet.GradNorm(d.Params()); norm > 1.0e-3+1.0e-12 {
+		t.Errorf("Norm of applied gradients is %v, want at most 1e-3.", norm)
+	}
+
+	// metrics report the gradients before clipping
+	metrics := nnet.BatchMetrics(d, 2)
+	if norm := metrics["grad_norm"]; norm <= 1.0e-3 {
+		t.Errorf("grad_norm is %v, want more than 1e-3.", norm)
+	}
+	if norm := metrics["grad_norm_clipped"]; math.Abs(norm-1.0e-3) > 1.0e-12 {
+		t.Errorf("grad_norm_clipped is %v, want 1e-3.", norm)
+	}
+	if _, ok := metrics["grad_norm/layer0"]; !ok {
+		t.Errorf("BatchMetrics returns %v, want grad_norm/layer0.", metrics)
+	}
+}
+
+func TestMLPSaveModel(t *testing.T) {
+	d := NewMLP(nnet.NewRand(1))
+	d.AddLayerWithActivation(2, 3, nnet.LeakyReLU{Alpha: 0.2})
+	d.AddLayer(3, 1)
+
+	filename := filepath.Join(t.TempDir(), "mlp.nnet")
+	if err := nnet.SaveModelFile(filename, d, nnet.Binary); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := []float64{0.3, -0.7}
+	want, got := d.Forward(input), loaded.Forward(input)
+	if got[0] != want[0] {
+		t.Errorf("Loaded model returns %v, want %v.", got, want)
+	}
+	first := loaded.Layers[0].(*HiddenLayer)
+	if first.Activation.Name() != "leaky_relu(0.2)" {
+		t.Errorf("Activation of first layer is %v, want leaky_relu(0.2).",
+			first.Activation.Name())
+	}
+}
+
+func TestLoadRejectsOtherModels(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "rbm.json")
+	rbmDump := `{"W":{"Rows":1,"Cols":1,"Data":[0]},"B":[0],"C":[0],"NumHiddenUnits":1,"NumVisibleUnits":1}`
+	if err := os.WriteFile(filename, []byte(rbmDump), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(filename); err == nil {
+		t.Errorf("Load of a RBM dump returns no error.")
+	}
+}
+
+func TestMLPShapeErrors(t *testing.T) {
+	d := NewMLP(nnet.NewRand(1))
+	if err := d.AddLayer(2, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddLayer(4, 1); !errors.Is(err, nnet.ErrShapeMismatch) {
+		t.Errorf("AddLayer of unfit layer returns %v, want a shape error.", err)
+	}
+	if len(d.Layers) != 1 {
+		t.Errorf("Number of layers is %d after a failed AddLayer, want 1.",
+			len(d.Layers))
+	}
+	d.AddLayer(3, 1)
+
+	if _, err := d.Predict([]float64{1, 2, 3}); !errors.Is(err,
+		nnet.ErrShapeMismatch) {
+		t.Errorf("Predict of bad input returns %v, want a shape error.", err)
+	}
+	option := TrainingOption{LearningRate: 0.1, Epoches: 1, MiniBatchSize: 1}
+	err := d.Train([][]float64{{0, 1}, {1}}, [][]float64{{0}, {1}}, option)
+	if !errors.Is(err, nnet.ErrShapeMismatch) {
+		t.Errorf("Train on bad input returns %v, want a shape error.", err)
+	}
+	err = d.Train([][]float64{{0, 1}}, [][]float64{{0, 1}}, option)
+	if !errors.Is(err, nnet.ErrShapeMismatch) {
+		t.Errorf("Train on bad target returns %v, want a shape error.", err)
+	}
+
+	// Layers of the dump don't fit
+	filename := filepath.Join(t.TempDir(), "mlp.json")
+	d.Layers[1] = NewHiddenLayer(2, 1, nil, nil, d.Rand())
+	if err := d.Dump(filename); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(filename); !errors.Is(err, nnet.ErrShapeMismatch) {
+		t.Errorf("Load of inconsistent layers returns %v, want a shape error.",
+			err)
+	}
+}
+
+func newDropoutMLP(inverted bool) *MLP {
+	d := NewMLP(nnet.NewRand(1))
+	d.Add(&Dropout{Rate: 0.2, Inverted: inverted})
+	d.AddLayerWithActivation(3, 8, nnet.TanhActivation{})
+	d.Add(&Dropout{Rate: 0.5, Inverted: inverted})
+	d.AddLayer(8, 2)
+	return d
+}
+
+func TestMLPDropout(t *testing.T) {
+	rng := nnet.NewRand(1)
+	input := make([][]float64, 5)
+	target := make([][]float64, 5)
+	for n := range input {
+		input[n] = []float64{rng.NormFloat64(), rng.NormFloat64(),
+			rng.NormFloat64()}
+		target[n] = []float64{rng.Float64(), rng.Float64()}
+	}
+
+	for _, inverted := range []bool{false, true} {
+		d := newDropoutMLP(inverted)
+
+		// Inference is deterministic and consistent with its gradient
+		a, b := d.Forward(input[0]), d.Forward(input[0])
+		if a[0] != b[0] || a[1] != b[1] {
+			t.Errorf("Forward returns %v and %v for the same input.", a, b)
+		}
+		for _, r := range gradcheck.Check(d, input, target, 0) {
+			if r.RelativeError > 1.0e-6 {
+				t.Errorf("Gradient with inverted=%v: %v", inverted, r)
+			}
+		}
+
+		// Dropped units of a single sample get no gradient
+		d.SetTraining(true)
+		d.ComputeGradient(input[:1], target[:1])
+		gradW := d.Layers[3].(*HiddenLayer).GradW
+		zeros := 0
+		for j := 0; j < gradW.Rows; j++ {
+			if gradW.At(j, 0) == 0 {
+				zeros++
+			}
+		}
+		if zeros == 0 || zeros == gradW.Rows {
+			t.Errorf("%d of %d units are dropped in training.", zeros,
+				gradW.Rows)
+		}
+		d.SetTraining(false)
+
+		// Updates drop units even in inference mode
+		d.SupervisedMiniBatchUpdate(input[:1], target[:1])
+		gradW = d.Layers[3].(*HiddenLayer).GradW
+		zeros = 0
+		for j := 0; j < gradW.Rows; j++ {
+			if gradW.At(j, 0) == 0 {
+				zeros++
+			}
+		}
+		if zeros == 0 || zeros == gradW.Rows {
+			t.Errorf("%d of %d units are dropped in updates.", zeros,
+				gradW.Rows)
+		}
+		if d.Training() {
+			t.Errorf("MLP is in training mode after SupervisedMiniBatchUpdate.")
+		}
+	}
+
+	d := newDropoutMLP(true)
+	option := TrainingOption{LearningRate: 0.1, Epoches: 2, MiniBatchSize: 2}
+	if err := d.Train(input, target, option); err != nil {
+		t.Fatal(err)
+	}
+	if d.Training() {
+		t.Errorf("MLP is in training mode after Train.")
+	}
+
+	d.Layers[2].(*Dropout).Rate = 1
+	if err := d.Validate(); err == nil {
+		t.Errorf("Validate of dropout rate 1 returns no error.")
+	}
+}
+
+func TestMLPDropoutSaveAndLoad(t *testing.T) {
+	d := newDropoutMLP(true)
+	dir := t.TempDir()
+	for _, filename := range []string{"mlp.json", "mlp.nnet"} {
+		filename = filepath.Join(dir, filename)
+		var err error
+		if filepath.Ext(filename) == ".json" {
+			err = d.Dump(filename)
+		} else {
+			err = nnet.SaveModelFile(filename, d, nnet.Binary)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := Load(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, i := range []int{0, 2} {
+			got, want := loaded.Layers[i].(*Dropout), d.Layers[i].(*Dropout)
+			if got.Rate != want.Rate || got.Inverted != want.Inverted {
+				t.Errorf("Dropout of layer %d loaded from %s is %v, want %v.",
+					i, filepath.Base(filename), got, want)
+			}
+		}
+	}
+}
+
+// trainingMLP evaluates the objective as in training mode, where batch
+// normalization depends on the whole mini-batch.
+type trainingMLP struct {
+	*MLP
+}
+
+func (d trainingMLP) SupervisedObjective(input, target [][]float64) float64 {
+	for _, layer := range d.Layers {
+		input = layer.ForwardBatch(input, true, d.Rand())
+	}
+	loss := d.loss()
+	sum := 0.0
+	for i := range input {
+		sum += loss.Value(input[i], target[i])
+	}
+	return sum / float64(len(input))
+}
+
+func TestMLPBatchNormGradient(t *testing.T) {
+	rng := nnet.NewRand(1)
+	input := make([][]float64, 5)
+	target := make([][]float64, 5)
+	for n := range input {
+		input[n] = []float64{rng.NormFloat64(), rng.NormFloat64(),
+			rng.NormFloat64()}
+		target[n] = []float64{rng.Float64(), rng.Float64()}
+	}
+
+	d := NewMLP(rng)
+	d.AddBatchNormLayer(3, 4, nnet.TanhActivation{})
+	d.AddBatchNormLayer(4, 4, nil)
+	d.AddLayer(4, 2)
+	norms := []*BatchNorm{d.Layers[1].(*BatchNorm), d.Layers[4].(*BatchNorm)}
+	for _, b := range norms {
+		for i := range b.Gamma {
+			b.Gamma[i] = 0.5 + rng.Float64()
+			b.Beta[i] = rng.NormFloat64()
+		}
+	}
+	for _, r := range gradcheck.Check(d, input, target, 0) {
+		if r.RelativeError > 1.0e-6 {
+			t.Errorf("Gradient in inference: %v", r)
+		}
+	}
+
+	// Keep the running statistics while checking
+	for _, b := range norms {
+		b.Momentum = 1.0
+	}
+	d.SetTraining(true)
+	for _, r := range gradcheck.Check(trainingMLP{d}, input, target, 0) {
+		if r.RelativeError > 1.0e-6 {
+			t.Errorf("Gradient in training: %v", r)
+		}
+	}
+}
+
+func TestMLPBatchNorm(t *testing.T) {
+	input := [][]float64{{0, 0}, {0, 1}, {1, 0}, {1, 1}}
+	target := [][]float64{{0}, {1}, {1}, {0}}
+
+	// Mini-batches of shuffled copies have different statistics
+	var trainInput, trainTarget [][]float64
+	for i := 0; i < 4; i++ {
+		trainInput = append(trainInput, input...)
+		trainTarget = append(trainTarget, target...)
+	}
+
+	// Deep sigmoid network
+	d := NewMLP(nnet.NewRand(1))
+	d.AddBatchNormLayer(2, 10, nil)
+	for i := 0; i < 4; i++ {
+		d.AddBatchNormLayer(10, 10, nil)
+	}
+	d.AddLayer(10, 1)
+	option := TrainingOption{
+		LearningRate:  0.5,
+		Epoches:       1000,
+		MiniBatchSize: 8,
+		Shuffle:       true,
+		Seed:          1,
+	}
+	if err := d.Train(trainInput, trainTarget, option); err != nil {
+		t.Fatal(err)
+	}
+	if mean := d.Layers[1].(*BatchNorm).RunningMean; mean[0] == 0 {
+		t.Errorf("Running mean %v is not updated in training.", mean)
+	}
+	for i, val := range input {
+		predicted := d.Forward(val)
+		if e := math.Abs(target[i][0] - predicted[0]); e > 0.1 {
+			t.Errorf("Prediction Error %f, want less than 0.1.", e)
+		}
+	}
+
+	dir := t.TempDir()
+	for _, filename := range []string{"mlp.json", "mlp.nnet"} {
+		filename = filepath.Join(dir, filename)
+		var err error
+		if filepath.Ext(filename) == ".json" {
+			err = d.Dump(filename)
+		} else {
+			err = nnet.SaveModelFile(filename, d, nnet.Binary)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := Load(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, val := range input {
+			want, got := d.Forward(val), loaded.Forward(val)
+			if got[0] != want[0] {
+				t.Errorf("Model loaded from %s returns %v, want %v.",
+					filepath.Base(filename), got, want)
+			}
+		}
+	}
+
+	d.Layers[4].(*BatchNorm).Gamma = nil
+	if err := d.Validate(); !errors.Is(err, nnet.ErrShapeMismatch) {
+		t.Errorf("Validate of missing gamma returns %v, want a shape error.",
+			err)
+	}
+}
+
+// scaleLayer is a custom layer that multiplies each input by a factor.
+type scaleLayer struct {
+	Factor []float64
+	grad   []float64
+	input  [][]float64
+}
+
+func init() {
+	RegisterLayer("test_scale", func() Layer { return &scaleLayer{} })
+}
+
+func (l *scaleLayer) Kind() string { return "test_scale" }
+
+func (l *scaleLayer) Forward(input []float64) []float64 {
+	output := make([]float64, len(input))
+	for i, x := range input {
+		output[i] = l.Factor[i] * x
+	}
+	return output
+}
+
+func (l *scaleLayer) ForwardBatch(input [][]float64, training bool,
+	rng *rand.Rand) [][]float64 {
+	l.input = input
+	output := make([][]float64, len(input))
+	for n := range input {
+		output[n] = l.Forward(input[n])
+	}
+	return output
+}
+
+func (l *scaleLayer) Backward(grad [][]float64) [][]float64 {
+	l.grad = make([]float64, len(l.Factor))
+	result := make([][]float64, len(grad))
+	for n := range grad {
+		result[n] = make([]float64, len(grad[n]))
+		for i, g := range grad[n] {
+			l.grad[i] += g * l.input[n][i]
+			result[n][i] = g * l.Factor[i]
+		}
+	}
+	return result
+}
+
+func (l *scaleLayer) Params() []*nnet.Param {
+	if l.grad == nil {
+		l.grad = make([]float64, len(l.Factor))
+	}
+	return []*nnet.Param{{Name: "factor", Value: l.Factor, Grad: l.grad}}
+}
+
+func TestMLPLayers(t *testing.T) {
+	rng := nnet.NewRand(1)
+	input := make([][]float64, 5)
+	target := make([][]float64, 5)
+	for n := range input {
+		input[n] = []float64{rng.NormFloat64(), rng.NormFloat64(),
+			rng.NormFloat64()}
+		target[n] = []float64{rng.Float64(), rng.Float64()}
+	}
+
+	d := NewMLP(rng)
+	layers := []Layer{
+		NewHiddenLayer(3, 4, nnet.Linear{}, nil, rng),
+		&ActivationLayer{Activation: nnet.TanhActivation{}},
+		&Dropout{Rate: 0.3},
+		NewBatchNorm(4),
+		&scaleLayer{Factor: []float64{0.5, -1, 2, 1.5}},
+		NewHiddenLayer(4, 2, nil, nil, rng),
+	}
+	for _, layer := range layers {
+		if err := d.Add(layer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, r := range gradcheck.Check(d, input, target, 0) {
+		if r.RelativeError > 1.0e-6 {
+			t.Errorf("Gradient: %v", r)
+		}
+	}
+
+	dir := t.TempDir()
+	for _, filename := range []string{"mlp.json", "mlp.nnet"} {
+		filename = filepath.Join(dir, filename)
+		var err error
+		if filepath.Ext(filename) == ".json" {
+			err = d.Dump(filename)
+		} else {
+			err = nnet.SaveModelFile(filename, d, nnet.Binary)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := Load(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := loaded.Layers[4].(*scaleLayer); !ok {
+			t.Errorf("Layer 4 loaded from %s is %T, want *scaleLayer.",
+				filepath.Base(filename), loaded.Layers[4])
+		}
+		want, got := d.Forward(input[0]), loaded.Forward(input[0])
+		if got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("Model loaded from %s returns %v, want %v.",
+				filepath.Base(filename), got, want)
+		}
+	}
+
+	if err := d.Add(NewHiddenLayer(3, 1, nil, nil, rng)); !errors.Is(err,
+		nnet.ErrShapeMismatch) {
+		t.Errorf("Add of unfit layer returns %v, want a shape error.", err)
+	}
+}
+
+func TestMLPUnknownLayer(t *testing.T) {
+	var d MLP
+	unknown := []byte(`{"Layers":[{"Kind":"unknown","Layer":{}}]}`)
+	if err := json.Unmarshal(unknown, &d); err == nil {
+		t.Errorf("Unmarshal of an unknown layer returns no error.")
+	}
+}
+
+func TestMLPRegularization(t *testing.T) {
+	input := [][]float64{{0, 0}, {0, 1}, {1, 0}, {1, 1}}
+	target := [][]float64{{0}, {1}, {1}, {0}}
+
+	d := NewMLP(nnet.NewRand(1))
+	d.AddLayerWithActivation(2, 4, nnet.TanhActivation{})
+	d.AddLayer(4, 1)
+	option := TrainingOption{
+		LearningRate:  0.5,
+		Epoches:       100,
+		MiniBatchSize: 2,
+		Regularization: &nnet.Regularization{
+			Weights: nnet.Regularizer{L2: 1.0e-3, MaxNorm: 0.5},
+			Params:  map[string]nnet.Regularizer{"layer1": {L1: 1.0e-3}},
+		},
+	}
+	if err := d.Train(input, target, option); err != nil {
+		t.Fatal(err)
+	}
+
+	// Incoming weights of each unit
+	W := d.Layers[0].(*HiddenLayer).W
+	for j := 0; j < W.Cols; j++ {
+		sum := 0.0
+		for k := 0; k < W.Rows; k++ {
+			sum += W.At(k, j) * W.At(k, j)
+		}
+		if norm := math.Sqrt(sum); norm > 0.5+1.0e-12 {
+			t.Errorf("Norm of unit %d is %v, want at most 0.5.", j, norm)
+		}
+	}
+}
+
+func TestMLPLoadBaselineDump(t *testing.T) {
+	// Written by Dump of the first version, with weights as arrays of rows
+	d, err := Load(filepath.Join("testdata", "baseline.json"))
+	if err != nil {
+		t.Fatalf("Load returns %v, want nil.", err)
+	}
+	want := 0.7377283482742211
+	if y := d.Forward([]float64{0, 1})[0]; math.Abs(y-want) > 1.0e-12 {
+		t.Errorf("Forward returns %v, want %v.", y, want)
+	}
+}
@@ -2,13 +2,15 @@
 package mlp3
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/r9y9/nnet"
+	"github.com/r9y9/nnet/initializer"
 	"math/rand"
 	"os"
-	"time"
+	"runtime"
 )
 
 const (
@@ -20,114 +22,257 @@ type NeuralNetwork struct {
 	OutputLayer  []float64
 	HiddenLayer  []float64
 	InputLayer   []float64
-	OutputWeight [][]float64
-	HiddenWeight [][]float64
+	OutputWeight *nnet.Matrix
+	HiddenWeight *nnet.Matrix
 	Option       TrainingOption
+
+	// Gradients computed by the last call of Feedback
+	GradOutputWeight *nnet.Matrix `json:"-"`
+	GradHiddenWeight *nnet.Matrix `json:"-"`
+
+	rng   *rand.Rand
+	norms nnet.GradNorms // of the last call of Feedback
 }
 
 type TrainingOption struct {
-	LearningRate  float64
-	Epoches       int
-	MiniBatchSize int
-	Monitoring    bool
+	LearningRate   float64
+	Epoches        int
+	MiniBatchSize  int
+	Monitoring     bool
+	ClipNorm       float64              // maximum L2 norm of all gradients, 0 disables
+	ClipValue      float64              // maximum absolute value of gradients, 0 disables
+	Regularization *nnet.Regularization // see nnet.Regularization
+	Loss           nnet.Loss            `json:"-"` // MeanSquaredError if nil
+	Optimizer      nnet.Optimizer       `json:"-"` // SGD with LearningRate if nil
+	Schedule       nnet.Schedule        `json:"-"` // constant LearningRate if nil
+	Callbacks      []nnet.Callback      `json:"-"`
 }
 
 // Load loads Neural Network from a dump file and return its instatnce.
 func Load(filename string) (*NeuralNetwork, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	decoder := json.NewDecoder(file)
 	net := &NeuralNetwork{}
-	err = decoder.Decode(net)
-
-	if err != nil {
+	if err := nnet.LoadFile(filename, net); err != nil {
 		return nil, err
 	}
-
 	return net, nil
 }
 
 // NewNeuralNetwork returns a new network instance with the number of
 // input units, number of hidden units and number output units
-// of the network.
+// of the network. init initializes weights and rng is used in
+// initialization and training. Both may be nil; a nil rng is replaced by
+// a generator seeded by the current time.
 func NewNeuralNetwork(numInputUnits,
-	numHiddenUnits, numOutputUnits int) *NeuralNetwork {
+	numHiddenUnits, numOutputUnits int,
+	init initializer.Initializer, rng *rand.Rand) *NeuralNetwork {
 	net := new(NeuralNetwork)
-	rand.Seed(time.Now().UnixNano())
+	net.rng = nnet.DefaultRand(rng)
 
 	// Layers
-	net.InputLayer = make([]float64, numInputUnits+1) // plus bias
-	net.HiddenLayer = make([]float64, numHiddenUnits)
+	net.InputLayer = make([]float64, numInputUnits+1)   // plus bias
+	net.HiddenLayer = make([]float64, numHiddenUnits+1) // plus bias
 	net.OutputLayer = make([]float64, numOutputUnits)
 
 	// Weights
-	net.OutputWeight = nnet.MakeMatrix(numHiddenUnits, numOutputUnits)
-	net.HiddenWeight = nnet.MakeMatrix(numInputUnits+1, numHiddenUnits)
+	net.OutputWeight = nnet.NewMatrix(numHiddenUnits+1, numOutputUnits)
+	net.HiddenWeight = nnet.NewMatrix(numInputUnits+1, numHiddenUnits)
 
-	net.InitParam()
+	net.InitParam(init)
 	return net
 }
 
+// Rand returns the random number generator of the network. Networks loaded
+// from dump files get a generator seeded by the current time.
+func (net *NeuralNetwork) Rand() *rand.Rand {
+	if net.rng == nil {
+		net.rng = nnet.DefaultRand(nil)
+	}
+	return net.rng
+}
+
+// SetRand sets the random number generator used in training.
+func (net *NeuralNetwork) SetRand(rng *rand.Rand) {
+	net.rng = rng
+}
+
 // Dump writes Neural Network parameters to file in json format.
 func (net *NeuralNetwork) Dump(filename string) error {
 	return nnet.DumpAsJson(filename, net)
 }
 
-// InitParam perform heuristic initialization of NN parameters.
-func (net *NeuralNetwork) InitParam() {
-	for i := range net.HiddenWeight {
-		for j := range net.HiddenWeight[i] {
-			net.HiddenWeight[i][j] = rand.Float64() - 0.5
-		}
+func init() {
+	nnet.RegisterModel("mlp3", func() nnet.Model { return &NeuralNetwork{} })
+}
+
+// Kind implements nnet.Model.
+func (net *NeuralNetwork) Kind() string {
+	return "mlp3"
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. Only the weights are
+// encoded; training options are not.
+func (net *NeuralNetwork) MarshalBinary() ([]byte, error) {
+	var e nnet.BinaryEncoder
+	e.Matrix(net.HiddenWeight)
+	e.Matrix(net.OutputWeight)
+	return e.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (net *NeuralNetwork) UnmarshalBinary(b []byte) error {
+	d := nnet.NewBinaryDecoder(b)
+	hiddenWeight, outputWeight := d.Matrix(), d.Matrix()
+	if err := d.Finish(); err != nil {
+		return err
 	}
+	if hiddenWeight.Cols+1 != outputWeight.Rows {
+		return fmt.Errorf("mlp3: weights %dx%d and %dx%d don't match",
+			hiddenWeight.Rows, hiddenWeight.Cols,
+			outputWeight.Rows, outputWeight.Cols)
+	}
+	net.HiddenWeight, net.OutputWeight = hiddenWeight, outputWeight
+	net.InputLayer = make([]float64, hiddenWeight.Rows)
+	net.HiddenLayer = make([]float64, outputWeight.Rows)
+	net.OutputLayer = make([]float64, outputWeight.Cols)
+	return nil
+}
 
-	for i := range net.OutputWeight {
-		for j := range net.OutputWeight[i] {
-			net.OutputWeight[i][j] = rand.Float64() - 0.5
-		}
+// UnmarshalJSON implements json.Unmarshaler.
+func (net *NeuralNetwork) UnmarshalJSON(b []byte) error {
+	type network NeuralNetwork
+	if err := json.Unmarshal(b, (*network)(net)); err != nil {
+		return err
+	}
+	net.upgrade()
+	return nil
+}
+
+// upgrade converts json dumps of the first version, in which the bias unit
+// of the hidden layer overwrote the last hidden unit, so that the output
+// weights had a row per column of the hidden weights. The hidden weights of
+// the overwritten unit had no effect and are dropped.
+func (net *NeuralNetwork) upgrade() {
+	h, o := net.HiddenWeight, net.OutputWeight
+	if h == nil || o == nil || h.Cols == 0 || h.Cols != o.Rows {
+		return
+	}
+	w := nnet.NewMatrix(h.Rows, h.Cols-1)
+	for i := 0; i < h.Rows; i++ {
+		copy(w.Row(i), h.Row(i))
+	}
+	net.HiddenWeight = w
+}
+
+// InitParam initializes weights by init. If init is nil, it performs
+// a heuristic initialization from U(-0.5, 0.5).
+func (net *NeuralNetwork) InitParam(init initializer.Initializer) {
+	if init == nil {
+		init = initializer.Uniform{Min: -0.5, Max: 0.5}
 	}
+
+	init.Init(net.HiddenWeight, len(net.InputLayer), len(net.HiddenLayer)-1,
+		net.Rand())
+	init.Init(net.OutputWeight, len(net.HiddenLayer), len(net.OutputLayer),
+		net.Rand())
 }
 
 // Forward performs a forward transfer algorithm of Neural network
-// and returns the output.
+// and returns the output. The activations of all layers are kept in
+// InputLayer, HiddenLayer and OutputLayer for Feedback, so Forward must not
+// be called concurrently; use ForwardBatch instead.
 func (net *NeuralNetwork) Forward(input []float64) []float64 {
-	output := make([]float64, len(net.OutputLayer))
+	inputLayer, hiddenLayer, output := net.forward(input)
+	copy(net.InputLayer, inputLayer)
+	copy(net.HiddenLayer, hiddenLayer)
+	net.OutputLayer = output
+	return output
+}
 
-	if len(input)+1 != len(net.InputLayer) {
-		panic("Dimention doesn't match: The number units of input layer")
+// Predict is like Forward but returns an error instead of panicking if
+// input doesn't match the network.
+func (net *NeuralNetwork) Predict(input []float64) ([]float64, error) {
+	err := nnet.CheckSize("input", len(net.InputLayer)-1, len(input))
+	if err != nil {
+		return nil, err
 	}
+	return net.Forward(input), nil
+}
 
-	// Copy
-	for i := range input {
-		net.InputLayer[i] = input[i]
+// Validate implements nnet.Validator. It checks that the weights match the
+// numbers of units.
+func (net *NeuralNetwork) Validate() error {
+	if net.HiddenWeight == nil || net.OutputWeight == nil {
+		return errors.New("mlp3: no weights")
+	}
+	checks := []struct {
+		what             string
+		expected, actual int
+	}{
+		{"hidden weight rows", len(net.InputLayer), net.HiddenWeight.Rows},
+		{"hidden weight columns", len(net.HiddenLayer) - 1, net.HiddenWeight.Cols},
+		{"output weight rows", len(net.HiddenLayer), net.OutputWeight.Rows},
+		{"output weight columns", len(net.OutputLayer), net.OutputWeight.Cols},
+	}
+	for _, c := range checks {
+		if err := nnet.CheckSize(c.what, c.expected, c.actual); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateShape implements nnet.ShapeValidator. target may be nil.
+func (net *NeuralNetwork) ValidateShape(input, target [][]float64) error {
+	err := nnet.CheckRows("input", input, len(net.InputLayer)-1)
+	if err != nil {
+		return err
 	}
-	net.InputLayer[len(net.InputLayer)-1] = Bias
+	return nnet.CheckRows("target", target, len(net.OutputLayer))
+}
 
-	// Transfer to hidden layer from input layer
-	for i := 0; i < len(net.HiddenLayer)-1; i++ {
-		sum := 0.0
-		for j := range net.InputLayer {
-			sum += net.HiddenWeight[j][i] * net.InputLayer[j]
+// ForwardBatch performs a forward transfer algorithm for all inputs
+// concurrently and returns the outputs.
+func (net *NeuralNetwork) ForwardBatch(input [][]float64) [][]float64 {
+	predicted := make([][]float64, len(input))
+	nnet.ParallelFor(len(input), runtime.GOMAXPROCS(0), func(c, b, e int) {
+		for i := b; i < e; i++ {
+			_, _, predicted[i] = net.forward(input[i])
 		}
-		net.HiddenLayer[i] = nnet.Sigmoid(sum)
+	})
+	return predicted
+}
+
+// forward returns the activations of input, hidden and output layers
+// without modifying net.
+func (net *NeuralNetwork) forward(input []float64) ([]float64, []float64,
+	[]float64) {
+	inputLayer := make([]float64, len(net.InputLayer))
+	hiddenLayer := make([]float64, len(net.HiddenLayer))
+	output := make([]float64, len(net.OutputLayer))
+
+	if len(input)+1 != len(inputLayer) {
+		panic(&nnet.ShapeError{What: "input", Expected: len(inputLayer) - 1,
+			Actual: len(input)})
+	}
+
+	// Copy
+	copy(inputLayer, input)
+	inputLayer[len(inputLayer)-1] = Bias
+
+	// Transfer to hidden layer from input layer; the bias unit is the last
+	net.HiddenWeight.MulVecTrans(inputLayer, hiddenLayer[:len(hiddenLayer)-1])
+	for i := 0; i < len(hiddenLayer)-1; i++ {
+		hiddenLayer[i] = nnet.Sigmoid(hiddenLayer[i])
 	}
-	net.HiddenLayer[len(net.HiddenLayer)-1] = Bias
+	hiddenLayer[len(hiddenLayer)-1] = Bias
 
 	// Transfer to output layer from hidden layer
-	for i := 0; i < len(net.OutputLayer); i++ {
-		sum := 0.0
-		for j := range net.HiddenLayer {
-			sum += net.OutputWeight[j][i] * net.HiddenLayer[j]
-		}
-		output[i] = nnet.Sigmoid(sum)
+	net.OutputWeight.MulVecTrans(hiddenLayer, output)
+	for i := range output {
+		output[i] = nnet.Sigmoid(output[i])
 	}
-	net.OutputLayer = output
 
-	return output
+	return inputLayer, hiddenLayer, output
 }
 
 func (net *NeuralNetwork) ComputeDelta(predicted,
@@ -136,18 +281,16 @@ func (net *NeuralNetwork) ComputeDelta(predicted,
 	hiddenDelta := make([]float64, len(net.HiddenLayer))
 
 	// Output Delta
+	lossGrad := net.loss().Gradient(predicted, target)
 	for i := 0; i < len(net.OutputLayer); i++ {
-		outputDelta[i] = (predicted[i] - target[i]) *
-			nnet.DSigmoid(predicted[i])
+		outputDelta[i] = lossGrad[i] * nnet.DSigmoid(predicted[i])
 	}
 
-	// Hidden Delta
-	for i := 0; i < len(net.HiddenLayer); i++ {
-		sum := 0.0
-		for j := range net.OutputLayer {
-			sum += net.OutputWeight[i][j] * outputDelta[j]
-		}
-		hiddenDelta[i] = sum * nnet.DSigmoid(net.HiddenLayer[i])
+	// Hidden Delta, except for the bias unit
+	net.OutputWeight.MulVec(outputDelta, hiddenDelta)
+	hiddenDelta = hiddenDelta[:len(hiddenDelta)-1]
+	for i := range hiddenDelta {
+		hiddenDelta[i] *= nnet.DSigmoid(net.HiddenLayer[i])
 	}
 
 	return outputDelta, hiddenDelta
@@ -155,40 +298,118 @@ func (net *NeuralNetwork) ComputeDelta(predicted,
 
 // Feedback performs a backward transfer algorithm.
 func (net *NeuralNetwork) Feedback(predicted, target []float64) {
+	net.GradOutputWeight = nnet.NewMatrix(net.OutputWeight.Dims())
+	net.GradHiddenWeight = nnet.NewMatrix(net.HiddenWeight.Dims())
+	net.accumulateGradient(1.0, predicted, target)
+
+	params := net.Params()
+	net.norms.Clip(params, net.Option.ClipNorm, net.Option.ClipValue)
+	optimizer := net.optimizer()
+	net.Option.Regularization.AddGradients(params)
+	for _, p := range params {
+		optimizer.Update(p)
+	}
+	net.Option.Regularization.Constrain(params, optimizer.LearningRate())
+}
+
+// GradNorms returns the norms of the gradients of the last call of Feedback
+// before clipping, see nnet.GradNorms.
+func (net *NeuralNetwork) GradNorms() nnet.Metrics {
+	return net.norms.Metrics()
+}
+
+// ComputeGradient computes the gradients of SupervisedObjective and stores
+// them in GradOutputWeight and GradHiddenWeight without updating weights.
+// Like Forward, it overwrites the activations of the layers.
+func (net *NeuralNetwork) ComputeGradient(input, target [][]float64) {
+	net.GradOutputWeight = nnet.NewMatrix(net.OutputWeight.Dims())
+	net.GradHiddenWeight = nnet.NewMatrix(net.HiddenWeight.Dims())
+	scale := 1.0 / float64(len(input))
+	for i := range input {
+		net.accumulateGradient(scale, net.Forward(input[i]), target[i])
+	}
+}
+
+// accumulateGradient adds scale times the gradient for the sample last
+// passed to Forward to the gradients of the weights.
+func (net *NeuralNetwork) accumulateGradient(scale float64, predicted,
+	target []float64) {
 	outputDelta, hiddenDelta := net.ComputeDelta(predicted, target)
 
-	// Update Weight of Output layer
-	for i := range net.OutputLayer {
-		for j := 0; j < len(net.HiddenLayer); j++ {
-			net.OutputWeight[j][i] -= net.Option.LearningRate *
-				outputDelta[i] * net.HiddenLayer[j]
-		}
+	// Gradient of Weight of Output layer
+	net.GradOutputWeight.AddOuter(scale, net.HiddenLayer, outputDelta)
+
+	// Gradient of Weight of Hidden layer
+	net.GradHiddenWeight.AddOuter(scale, net.InputLayer, hiddenDelta)
+}
+
+// Params returns the weights and the biases of the network together with
+// their gradients computed by the last call of Feedback or ComputeGradient.
+func (net *NeuralNetwork) Params() []*nnet.Param {
+	if net.GradOutputWeight == nil {
+		net.GradOutputWeight = nnet.NewMatrix(net.OutputWeight.Dims())
+		net.GradHiddenWeight = nnet.NewMatrix(net.HiddenWeight.Dims())
 	}
+	params := weightAndBias("Output", net.OutputWeight, net.GradOutputWeight)
+	return append(params, weightAndBias("Hidden", net.HiddenWeight,
+		net.GradHiddenWeight)...)
+}
 
-	// Update Weight of Hidden layer
-	for i := 0; i < len(net.HiddenLayer); i++ {
-		for j := range net.InputLayer {
-			net.HiddenWeight[j][i] -= net.Option.LearningRate *
-				hiddenDelta[i] * net.InputLayer[j]
-		}
+// weightAndBias splits a weight matrix into the weights and the biases in
+// its last row, which connects the bias unit of the layer below.
+func weightAndBias(layer string, w, grad *nnet.Matrix) []*nnet.Param {
+	n := (w.Rows - 1) * w.Cols
+	return []*nnet.Param{
+		{Name: layer + "Weight", Value: w.Data[:n], Grad: grad.Data[:n],
+			Rows: w.Rows - 1, Cols: w.Cols},
+		{Name: layer + "Bias", Value: w.Data[n:], Grad: grad.Data[n:]},
+	}
+}
+
+// LearningRate returns the learning rate of the optimizer.
+func (net *NeuralNetwork) LearningRate() float64 {
+	return net.optimizer().LearningRate()
+}
+
+// SetLearningRate sets the learning rate of the optimizer.
+func (net *NeuralNetwork) SetLearningRate(rate float64) {
+	net.optimizer().SetLearningRate(rate)
+}
+
+// optimizer returns the optimizer used in training. It defaults to SGD.
+func (net *NeuralNetwork) optimizer() nnet.Optimizer {
+	if net.Option.Optimizer == nil {
+		net.Option.Optimizer = nnet.NewSGD(net.Option.LearningRate)
 	}
+	return net.Option.Optimizer
 }
 
 // Objective returns the objective function to optimize in training network.
 func (net *NeuralNetwork) Objective(input, target []float64) float64 {
-	sum := 0.0
-	for i := 0; i < len(target); i++ {
-		sum += (input[i] - target[i]) * (input[i] - target[i])
+	return net.loss().Value(input, target)
+}
+
+// loss returns the loss function to optimize.
+func (net *NeuralNetwork) loss() nnet.Loss {
+	if net.Option.Loss == nil {
+		return nnet.MeanSquaredError{}
 	}
-	return 0.5 * sum
+	return net.Option.Loss
 }
 
 // Objective returns the objective function for all data.
 func (net *NeuralNetwork) ObjectiveForAllData(input,
+	target [][]float64) float64 {
+	return net.SupervisedObjective(input, target)
+}
+
+// SupervisedObjective returns the mean loss of the network over all data.
+func (net *NeuralNetwork) SupervisedObjective(input,
 	target [][]float64) float64 {
 	sum := 0.0
 	for i := 0; i < len(input); i++ {
-		sum += net.Objective(input[i], target[i])
+		_, _, predicted := net.forward(input[i])
+		sum += net.Objective(predicted, target[i])
 	}
 	return sum / float64(len(input))
 }
@@ -199,7 +420,7 @@ func (net *NeuralNetwork) ParseTrainingOption(option TrainingOption) error {
 	if net.Option.Epoches <= 0 {
 		return errors.New("Epoches must be larger than zero.")
 	}
-	if net.Option.LearningRate == 0 {
+	if net.Option.Optimizer == nil && net.Option.LearningRate == 0 {
 		return errors.New("Learning rate must be specified to train NN.")
 	}
 
@@ -207,26 +428,100 @@ func (net *NeuralNetwork) ParseTrainingOption(option TrainingOption) error {
 }
 
 // SupervisedSGD performs stochastic gradient decent to optimize network.
-func (net *NeuralNetwork) SupervisedSGD(input [][]float64, target [][]float64) {
-	for epoch := 0; epoch < net.Option.Epoches; epoch++ {
-		// Get random sample
-		randIndex := rand.Intn(len(input))
-		x := input[randIndex]
-		t := target[randIndex]
-
-		// One feed-fowrward procedure
-		predicted := net.Forward(x)
-		net.Feedback(predicted, t)
-
-		// Print objective function
-		if net.Option.Monitoring {
-			fmt.Println(epoch, net.Objective(predicted, t))
+func (net *NeuralNetwork) SupervisedSGD(input [][]float64,
+	target [][]float64) error {
+	return net.SupervisedSGDContext(context.Background(), input, target)
+}
+
+// SupervisedSGDContext is like SupervisedSGD but stops before the next
+// iteration when ctx is done and returns ctx.Err().
+func (net *NeuralNetwork) SupervisedSGDContext(ctx context.Context,
+	input [][]float64, target [][]float64) error {
+	if len(input) == 0 {
+		return errors.New("No training data.")
+	}
+	if len(target) != len(input) {
+		return errors.New("Numbers of input and target data differ.")
+	}
+	if err := net.ValidateShape(input, target); err != nil {
+		return err
+	}
+
+	observer, observed := net.Option.Schedule.(nnet.ObjectiveObserver)
+	callbacks := nnet.Callbacks(net.Option.Callbacks)
+	if net.Option.Monitoring {
+		callbacks = append(callbacks[:len(callbacks):len(callbacks)],
+			&nnet.Printer{W: os.Stdout})
+	}
+
+	var metrics nnet.Metrics
+	err := func() error {
+		for epoch := 0; epoch < net.Option.Epoches; epoch++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := callbacks.OnEpochBegin(net, epoch); err != nil {
+				return err
+			}
+
+			// Get random sample
+			randIndex := net.Rand().Intn(len(input))
+			x := input[randIndex]
+			t := target[randIndex]
+
+			// Each iteration is regarded as an epoch
+			if net.Option.Schedule != nil {
+				net.SetLearningRate(net.Option.Schedule.LearningRate(epoch, epoch))
+			}
+
+			// One feed-fowrward procedure
+			predicted := net.Forward(x)
+			net.Feedback(predicted, t)
+
+			if len(callbacks) == 0 && !observed {
+				continue
+			}
+			err := callbacks.OnBatchEnd(net, epoch, 0, nnet.BatchMetrics(net, 1))
+			if err != nil {
+				return err
+			}
+
+			// Objective function of the sample
+			objective := net.Objective(predicted, t)
+			if observed {
+				observer.ObserveObjective(epoch, objective)
+			}
+			metrics = nnet.Metrics{"objective": objective}
+			if err := callbacks.OnEpochEnd(net, epoch, metrics); err != nil {
+				return err
+			}
 		}
+		return nil
+	}()
+	canceled := err != nil && err == ctx.Err()
+	if err != nil && err != nnet.ErrStopTraining && !canceled {
+		return err
+	}
+
+	if endErr := callbacks.OnTrainEnd(net, metrics); endErr != nil &&
+		endErr != nnet.ErrStopTraining {
+		return endErr
+	}
+	if canceled {
+		return err
 	}
+	return nil
 }
 
 // Train performs supervised network training.
 func (net *NeuralNetwork) Train(input [][]float64,
+	target [][]float64, option TrainingOption) error {
+	return net.TrainContext(context.Background(), input, target, option)
+}
+
+// TrainContext is like Train but stops before the next iteration when ctx
+// is done and returns ctx.Err().
+func (net *NeuralNetwork) TrainContext(ctx context.Context, input [][]float64,
 	target [][]float64, option TrainingOption) error {
 	err := net.ParseTrainingOption(option)
 	if err != nil {
@@ -234,7 +529,5 @@ func (net *NeuralNetwork) Train(input [][]float64,
 	}
 
 	// Perform SupervisedSGD
-	net.SupervisedSGD(input, target)
-
-	return nil
+	return net.SupervisedSGDContext(ctx, input, target)
 }
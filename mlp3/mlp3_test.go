@@ -1,7 +1,11 @@
 package mlp3
 
 import (
+	"errors"
+	"github.com/r9y9/nnet"
+	"github.com/r9y9/nnet/gradcheck"
 	"math"
+	"path/filepath"
 	"testing"
 )
 
@@ -10,7 +14,7 @@ func TestNN(t *testing.T) {
 	input := [][]float64{{0, 0}, {0, 1}, {1, 0}, {1, 1}}
 	target := [][]float64{{0}, {1}, {1}, {0}}
 
-	network := NewNeuralNetwork(2, 20, 1)
+	network := NewNeuralNetwork(2, 20, 1, nil, nil)
 	option := TrainingOption{
 		LearningRate: 0.1,
 		Epoches:      50000,
@@ -36,7 +40,7 @@ func BenchmarkNN(b *testing.B) {
 	input := [][]float64{{0, 0}, {0, 1}, {1, 0}, {1, 1}}
 	target := [][]float64{{0}, {1}, {1}, {0}}
 
-	network := NewNeuralNetwork(2, 10, 1)
+	network := NewNeuralNetwork(2, 10, 1, nil, nil)
 	option := TrainingOption{
 		LearningRate: 0.1,
 		Epoches:      50000,
@@ -47,3 +51,87 @@ func BenchmarkNN(b *testing.B) {
 		network.Train(input, target, option)
 	}
 }
+
+func TestForwardBatch(t *testing.T) {
+	network := NewNeuralNetwork(2, 5, 3, nil, nnet.NewRand(1))
+	input := [][]float64{{0, 0}, {0, 1}, {1, 0}, {1, 1}, {0.5, 0.5}}
+
+	predicted := network.ForwardBatch(input)
+	for i := range input {
+		want := network.Forward(input[i])
+		for j := range want {
+			if predicted[i][j] != want[j] {
+				t.Errorf("ForwardBatch returns %v for input %d, want %v.",
+					predicted[i], i, want)
+				break
+			}
+		}
+	}
+}
+
+func TestGradient(t *testing.T) {
+	rng := nnet.NewRand(1)
+	input := make([][]float64, 5)
+	target := make([][]float64, 5)
+	for n := range input {
+		input[n] = []float64{rng.NormFloat64(), rng.NormFloat64()}
+		target[n] = []float64{rng.Float64(), rng.Float64()}
+	}
+
+	network := NewNeuralNetwork(2, 4, 2, nil, rng)
+	for _, r := range gradcheck.Check(network, input, target, 0) {
+		if r.RelativeError > 1.0e-6 {
+			t.Errorf("Gradient: %v", r)
+		}
+	}
+}
+
+func TestShapeErrors(t *testing.T) {
+	network := NewNeuralNetwork(2, 3, 1, nil, nnet.NewRand(1))
+	if _, err := network.Predict([]float64{1}); !errors.Is(err,
+		nnet.ErrShapeMismatch) {
+		t.Errorf("Predict of bad input returns %v, want a shape error.", err)
+	}
+	option := TrainingOption{LearningRate: 0.1, Epoches: 1}
+	err := network.Train([][]float64{{0, 1}, {1}}, [][]float64{{0}, {1}},
+		option)
+	if !errors.Is(err, nnet.ErrShapeMismatch) {
+		t.Errorf("Train on bad input returns %v, want a shape error.", err)
+	}
+}
+
+func TestHiddenBias(t *testing.T) {
+	network := NewNeuralNetwork(2, 3, 1, nil, nnet.NewRand(1))
+	input := []float64{0.5, -1}
+	network.Forward(input)
+	if len(network.HiddenLayer) != 4 || network.HiddenLayer[3] != Bias {
+		t.Fatalf("HiddenLayer is %v, want 3 units and the bias.",
+			network.HiddenLayer)
+	}
+
+	// The last hidden unit is not overwritten by the bias
+	sum := 0.0
+	for i, x := range append(input, Bias) {
+		sum += x * network.HiddenWeight.At(i, 2)
+	}
+	if h := network.HiddenLayer[2]; math.Abs(h-nnet.Sigmoid(sum)) > 1.0e-12 {
+		t.Errorf("Last hidden unit is %v, want %v.", h, nnet.Sigmoid(sum))
+	}
+	network.ComputeGradient([][]float64{input}, [][]float64{{1}})
+	if g := network.GradHiddenWeight.At(0, 2); g == 0 {
+		t.Errorf("Gradient of the weights of the last hidden unit is 0.")
+	}
+}
+
+func TestLoadBaselineDump(t *testing.T) {
+	// Written by Dump of the first version, with weights as arrays of rows
+	// and the bias unit in place of the last hidden unit
+	network, err := Load(filepath.Join("testdata", "baseline.json"))
+	if err != nil {
+		t.Fatalf("Load returns %v, want nil.", err)
+	}
+	want := 0.5514880964708241
+	if y := network.Forward([]float64{0, 1})[0]; math.Abs(y-want) > 1.0e-12 {
+		t.Errorf("Forward returns %v, want %v.", y, want)
+	}
+}
@@ -0,0 +1,396 @@
+package nnet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+// Model is a network that can be saved by SaveModel. Kind identifies the
+// type of the model in saved files and must be registered by RegisterModel
+// for LoadModel to restore it.
+type Model interface {
+	Kind() string
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// Format is the encoding of the payload of a model file.
+type Format uint8
+
+const (
+	Binary Format = iota // compact binary encoding by Model.MarshalBinary
+	JSON                 // json encoding of the model
+)
+
+// A model file consists of a fixed header followed by the payload:
+//
+//	magic    [4]byte  "NNET"
+//	version  uint16
+//	format   uint8
+//	kind     uint8 length + bytes
+//	size     uint64   length of payload
+//	checksum uint32   CRC-32 (IEEE) of payload
+//	payload  [size]byte
+//
+// All integers are little endian.
+const (
+	modelMagic   = "NNET"
+	modelVersion = 1
+)
+
+var (
+	ErrNotModelFile = errors.New("nnet: not a model file")
+	ErrChecksum     = errors.New("nnet: model checksum mismatch")
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]func() Model)
+)
+
+// RegisterModel makes a model kind available to LoadModel. newModel must
+// return an empty model to decode into. Model packages register their kinds
+// in init, so they have to be imported for LoadModel to know them.
+func RegisterModel(kind string, newModel func() Model) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := registry[kind]; dup {
+		panic("nnet: RegisterModel called twice for kind " + kind)
+	}
+	registry[kind] = newModel
+}
+
+// SaveModel writes m to w in the given format.
+func SaveModel(w io.Writer, m Model, format Format) error {
+	var payload []byte
+	var err error
+	switch format {
+	case Binary:
+		payload, err = m.MarshalBinary()
+	case JSON:
+		payload, err = json.Marshal(m)
+	default:
+		return fmt.Errorf("nnet: unknown model format %d", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	kind := m.Kind()
+	if len(kind) > math.MaxUint8 {
+		return fmt.Errorf("nnet: model kind %q is too long", kind)
+	}
+
+	var header bytes.Buffer
+	header.WriteString(modelMagic)
+	binary.Write(&header, binary.LittleEndian, uint16(modelVersion))
+	header.WriteByte(byte(format))
+	header.WriteByte(byte(len(kind)))
+	header.WriteString(kind)
+	binary.Write(&header, binary.LittleEndian, uint64(len(payload)))
+	binary.Write(&header, binary.LittleEndian, crc32.ChecksumIEEE(payload))
+
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+	return err
+}
+
+// LoadModel reads a model written by SaveModel and returns it as the type
+// registered for its kind.
+func LoadModel(r io.Reader) (Model, error) {
+	kind, format, payload, err := readModel(r)
+	if err != nil {
+		return nil, err
+	}
+
+	registryMu.RLock()
+	newModel, ok := registry[kind]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("nnet: unknown model kind %q", kind)
+	}
+
+	m := newModel()
+	if err := decodeModel(m, format, payload); err != nil {
+		return nil, err
+	}
+	if err := validate(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SaveModelFile writes m to file in the given format.
+func SaveModelFile(filename string, m Model, format Format) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := SaveModel(file, m, format); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// LoadModelFile reads a model written by SaveModelFile.
+func LoadModelFile(filename string) (Model, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return LoadModel(bufio.NewReader(file))
+}
+
+// LoadFile decodes a model file into m. Files without the model header are
+// decoded as plain json written by DumpAsJson, rejecting unknown fields so
+// that a dump of another type of model is not loaded silently.
+func LoadFile(filename string, m Model) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	magic, err := r.Peek(len(modelMagic))
+	if err != nil || string(magic) != modelMagic {
+		decoder := json.NewDecoder(r)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(m); err != nil {
+			return err
+		}
+		return validate(m)
+	}
+
+	kind, format, payload, err := readModel(r)
+	if err != nil {
+		return err
+	}
+	if kind != m.Kind() {
+		return fmt.Errorf("nnet: model kind is %q, want %q", kind, m.Kind())
+	}
+	if err := decodeModel(m, format, payload); err != nil {
+		return err
+	}
+	return validate(m)
+}
+
+// validate checks decoded models that implement Validator.
+func validate(m Model) error {
+	if v, ok := m.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// readModel reads the header and the payload of a model file.
+func readModel(r io.Reader) (string, Format, []byte, error) {
+	var fixed [len(modelMagic) + 4]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return "", 0, nil, ErrNotModelFile
+		}
+		return "", 0, nil, err
+	}
+	if string(fixed[:len(modelMagic)]) != modelMagic {
+		return "", 0, nil, ErrNotModelFile
+	}
+	version := binary.LittleEndian.Uint16(fixed[len(modelMagic):])
+	if version != modelVersion {
+		return "", 0, nil, fmt.Errorf("nnet: unsupported model version %d",
+			version)
+	}
+	format := Format(fixed[len(modelMagic)+2])
+	kind := make([]byte, fixed[len(modelMagic)+3])
+	if _, err := io.ReadFull(r, kind); err != nil {
+		return "", 0, nil, unexpectedEOF(err)
+	}
+
+	var size uint64
+	var checksum uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return "", 0, nil, unexpectedEOF(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &checksum); err != nil {
+		return "", 0, nil, unexpectedEOF(err)
+	}
+
+	// Read through a limited reader so that a corrupted size does not
+	// allocate a huge buffer up front.
+	var payload bytes.Buffer
+	n, err := io.Copy(&payload, io.LimitReader(r, int64(size)))
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if uint64(n) != size {
+		return "", 0, nil, io.ErrUnexpectedEOF
+	}
+	if crc32.ChecksumIEEE(payload.Bytes()) != checksum {
+		return "", 0, nil, ErrChecksum
+	}
+	return string(kind), format, payload.Bytes(), nil
+}
+
+func decodeModel(m Model, format Format, payload []byte) error {
+	switch format {
+	case Binary:
+		return m.UnmarshalBinary(payload)
+	case JSON:
+		return json.Unmarshal(payload, m)
+	}
+	return fmt.Errorf("nnet: unknown model format %d", format)
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// BinaryEncoder writes the binary payload of models. The zero value is ready
+// to use.
+type BinaryEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *BinaryEncoder) Int(v int) {
+	binary.Write(&e.buf, binary.LittleEndian, int64(v))
+}
+
+func (e *BinaryEncoder) String(s string) {
+	e.Int(len(s))
+	e.buf.WriteString(s)
+}
+
+func (e *BinaryEncoder) Float64s(v []float64) {
+	e.Int(len(v))
+	var b [8]byte
+	for _, x := range v {
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(x))
+		e.buf.Write(b[:])
+	}
+}
+
+func (e *BinaryEncoder) Matrix(m *Matrix) {
+	if !m.IsContiguous() {
+		m = m.Clone()
+	}
+	e.Int(m.Rows)
+	e.Int(m.Cols)
+	e.Float64s(m.Data)
+}
+
+// Bytes returns the encoded payload.
+func (e *BinaryEncoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// BinaryDecoder reads payloads written by BinaryEncoder. After the first
+// error all reads return zero values and Err reports the error.
+type BinaryDecoder struct {
+	b   []byte
+	err error
+}
+
+// NewBinaryDecoder returns a decoder reading from b.
+func NewBinaryDecoder(b []byte) *BinaryDecoder {
+	return &BinaryDecoder{b: b}
+}
+
+func (d *BinaryDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *BinaryDecoder) Int() int {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	v := int64(binary.LittleEndian.Uint64(b))
+	if v < math.MinInt32 || v > math.MaxInt32 {
+		d.err = fmt.Errorf("nnet: integer %d out of range", v)
+		return 0
+	}
+	return int(v)
+}
+
+func (d *BinaryDecoder) String() string {
+	return string(d.next(d.Int()))
+}
+
+func (d *BinaryDecoder) Float64s() []float64 {
+	n := d.Int()
+	if n > len(d.b)/8 {
+		d.next(-1)
+		return nil
+	}
+	b := d.next(8 * n)
+	if b == nil {
+		return nil
+	}
+	v := make([]float64, n)
+	for i := range v {
+		v[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[8*i:]))
+	}
+	return v
+}
+
+func (d *BinaryDecoder) Matrix() *Matrix {
+	rows, cols := d.Int(), d.Int()
+	data := d.Float64s()
+	if d.err != nil {
+		return nil
+	}
+	if rows < 0 || cols < 0 || len(data) != rows*cols {
+		d.err = fmt.Errorf("nnet: matrix data length %d doesn't match shape %dx%d",
+			len(data), rows, cols)
+		return nil
+	}
+	return NewMatrixFromData(rows, cols, data)
+}
+
+// More reports whether some bytes were not read yet. It lets models append
+// optional fields to their payloads.
+func (d *BinaryDecoder) More() bool {
+	return d.err == nil && len(d.b) != 0
+}
+
+// Err returns the first error encountered.
+func (d *BinaryDecoder) Err() error {
+	return d.err
+}
+
+// Finish returns the first error encountered or an error if some bytes
+// were not read. It is called after decoding the whole payload.
+func (d *BinaryDecoder) Finish() error {
+	if d.err == nil && len(d.b) != 0 {
+		return fmt.Errorf("nnet: %d trailing bytes in model payload", len(d.b))
+	}
+	return d.err
+}
@@ -0,0 +1,79 @@
+package nnet
+
+import (
+	"bytes"
+	"testing"
+)
+
+type fakeModel struct {
+	W *Matrix
+	B []float64
+}
+
+func (m *fakeModel) Kind() string { return "fake" }
+
+func (m *fakeModel) MarshalBinary() ([]byte, error) {
+	var e BinaryEncoder
+	e.Matrix(m.W)
+	e.Float64s(m.B)
+	return e.Bytes(), nil
+}
+
+func (m *fakeModel) UnmarshalBinary(b []byte) error {
+	d := NewBinaryDecoder(b)
+	m.W, m.B = d.Matrix(), d.Float64s()
+	return d.Finish()
+}
+
+func init() {
+	RegisterModel("fake", func() Model { return &fakeModel{} })
+}
+
+func TestSaveAndLoadModel(t *testing.T) {
+	m := &fakeModel{
+		W: NewMatrixFromRows([][]float64{{1, 2, 3}, {4, 5, 6}}),
+		B: []float64{-1, 0.5},
+	}
+
+	for _, format := range []Format{Binary, JSON} {
+		var buf bytes.Buffer
+		if err := SaveModel(&buf, m, format); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadModel(&buf)
+		if err != nil {
+			t.Fatalf("LoadModel returns error %v in format %d.", err, format)
+		}
+		f, ok := loaded.(*fakeModel)
+		if !ok {
+			t.Fatalf("LoadModel returns %T, want *fakeModel.", loaded)
+		}
+		if f.W.Rows != 2 || f.W.Cols != 3 || f.W.At(1, 2) != 6 || f.B[0] != -1 {
+			t.Errorf("LoadModel returns %v, want %v.", f, m)
+		}
+	}
+}
+
+func TestLoadModelErrors(t *testing.T) {
+	m := &fakeModel{W: NewMatrix(2, 2), B: []float64{1, 2}}
+	var buf bytes.Buffer
+	if err := SaveModel(&buf, m, Binary); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	corrupted := append([]byte(nil), b...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	if _, err := LoadModel(bytes.NewReader(corrupted)); err != ErrChecksum {
+		t.Errorf("LoadModel of corrupted payload returns %v, want %v.",
+			err, ErrChecksum)
+	}
+
+	if _, err := LoadModel(bytes.NewReader(b[:len(b)-1])); err == nil {
+		t.Errorf("LoadModel of truncated file returns no error.")
+	}
+
+	if _, err := LoadModel(bytes.NewReader([]byte(`{"W": null}`))); err != ErrNotModelFile {
+		t.Errorf("LoadModel of json returns %v, want %v.", err, ErrNotModelFile)
+	}
+}
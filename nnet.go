@@ -6,14 +6,44 @@ import (
 	"math"
 	"math/rand"
 	"os"
+	"runtime"
+	"time"
 )
 
 type Forwarder interface {
 	Forward(input []float64) []float64
 }
 
+// BatchForwarder is implemented by networks that can process many inputs at
+// once, typically on all available cores.
+type BatchForwarder interface {
+	ForwardBatch(input [][]float64) [][]float64
+}
+
+// ForwardBatch calls net.Forward for all inputs, splitting them across
+// runtime.GOMAXPROCS(0) goroutines. net.Forward must be safe for concurrent
+// use.
+func ForwardBatch(net Forwarder, input [][]float64) [][]float64 {
+	predicted := make([][]float64, len(input))
+	ParallelFor(len(input), runtime.GOMAXPROCS(0), func(c, b, e int) {
+		for i := b; i < e; i++ {
+			predicted[i] = net.Forward(input[i])
+		}
+	})
+	return predicted
+}
+
+// Test returns the index of the maximum output for every input. Networks
+// that implement BatchForwarder are evaluated by ForwardBatch.
 func Test(net Forwarder, input [][]float64) []int {
 	recognizedLabel := make([]int, len(input))
+	if b, ok := net.(BatchForwarder); ok {
+		for i, predicted := range b.ForwardBatch(input) {
+			recognizedLabel[i] = Argmax(predicted)
+		}
+		return recognizedLabel
+	}
+
 	for i, val := range input {
 		predicted := net.Forward(val)
 		recognizedLabel[i] = Argmax(predicted)
@@ -37,15 +67,12 @@ func DumpAsJson(filename string, obj interface{}) error {
 	return nil
 }
 
-func Forward(input []float64, W [][]float64, B []float64) []float64 {
-	numOutputUnits := len(B)
-	predicted := make([]float64, numOutputUnits)
-	for i := 0; i < numOutputUnits; i++ {
-		sum := 0.0
-		for j := range input {
-			sum += W[j][i] * input[j]
-		}
-		predicted[i] = Sigmoid(sum + B[i])
+// Forward returns sigmoid(W^T * input + B), where W is a matrix of size
+// len(input) x len(B).
+func Forward(input []float64, W *Matrix, B []float64) []float64 {
+	predicted := W.MulVecTrans(input, nil)
+	for i := range predicted {
+		predicted[i] = Sigmoid(predicted[i] + B[i])
 	}
 
 	return predicted
@@ -102,13 +129,41 @@ func Argmax(A []float64) int {
 	return x
 }
 
+// NewRand returns a new random number generator seeded by seed. Models
+// that are created with generators of the same seed are identical.
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}
+
+// DefaultRand returns rng if it is not nil, otherwise a new generator
+// seeded by the current time.
+func DefaultRand(rng *rand.Rand) *rand.Rand {
+	if rng != nil {
+		return rng
+	}
+	return NewRand(time.Now().UnixNano())
+}
+
+// RandomSubset returns numSamples samples randomly drawn from data using
+// the default source of math/rand.
 func RandomSubset(data [][]float64, numSamples int) [][]float64 {
+	return randomSubset(data, numSamples, rand.Intn)
+}
+
+// RandomSubsetRand is like RandomSubset but draws the samples from rng.
+func RandomSubsetRand(data [][]float64, numSamples int,
+	rng *rand.Rand) [][]float64 {
+	return randomSubset(data, numSamples, rng.Intn)
+}
+
+func randomSubset(data [][]float64, numSamples int,
+	intn func(int) int) [][]float64 {
 	if len(data) < numSamples {
 		numSamples = len(data)
 	}
 	subset := make([][]float64, numSamples)
 	for i := 0; i < numSamples; i++ {
-		randIndex := rand.Intn(len(data))
+		randIndex := intn(len(data))
 		subset[i] = data[randIndex]
 	}
 	return subset
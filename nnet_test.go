@@ -0,0 +1,21 @@
+package nnet
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRandomSubset(t *testing.T) {
+	data := [][]float64{{0}, {1}, {2}, {3}}
+	if subset := RandomSubset(data, 10); len(subset) != len(data) {
+		t.Errorf("RandomSubset returns %d samples, want %d.",
+			len(subset), len(data))
+	}
+
+	a := RandomSubsetRand(data, 3, NewRand(1))
+	b := RandomSubsetRand(data, 3, NewRand(1))
+	if len(a) != 3 || !reflect.DeepEqual(a, b) {
+		t.Errorf("RandomSubsetRand returns %v and %v, want the same 3 samples.",
+			a, b)
+	}
+}
@@ -0,0 +1,360 @@
+package nnet
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// Param is a named block of trainable parameters together with the gradient
+// of the objective to minimize with respect to them. Name must be unique
+// within a model since optimizers keep per-parameter state by name.
+type Param struct {
+	Name  string
+	Value []float64
+	Grad  []float64
+
+	// Rows and Cols are the shape of a weight matrix stored row-major in
+	// Value. They are zero for biases and other parameters that are not
+	// weights, which Regularization treats differently.
+	Rows, Cols int
+
+	// UnitsInRows reports whether the weights of each unit are the rows of
+	// the matrix rather than the columns, for max-norm constraints.
+	UnitsInRows bool
+}
+
+// GradNorm returns the L2 norm of the gradients of all params.
+func GradNorm(params []*Param) float64 {
+	sum := 0.0
+	for _, p := range params {
+		for _, g := range p.Grad {
+			sum += g * g
+		}
+	}
+	return math.Sqrt(sum)
+}
+
+// ClipGradients limits the gradients of params before they are applied.
+// Each element is first clipped to [-maxValue, maxValue], then all gradients
+// are rescaled so that their global L2 norm is at most maxNorm. A limit of
+// zero disables the corresponding clipping.
+func ClipGradients(params []*Param, maxNorm, maxValue float64) {
+	if maxValue > 0 {
+		for _, p := range params {
+			for i, g := range p.Grad {
+				p.Grad[i] = math.Max(-maxValue, math.Min(maxValue, g))
+			}
+		}
+	}
+	if maxNorm > 0 {
+		norm := GradNorm(params)
+		if norm <= maxNorm {
+			return
+		}
+		scale := maxNorm / norm
+		for _, p := range params {
+			for i := range p.Grad {
+				p.Grad[i] *= scale
+			}
+		}
+	}
+}
+
+// GradNorms records the norms of the gradients of an update before they
+// are clipped or regularized, so that BatchMetrics reports the gradients of
+// the objective rather than those that were applied. The zero value is
+// ready to use.
+type GradNorms struct {
+	metrics Metrics
+}
+
+// Clip is like ClipGradients but first records the norms of the gradients:
+// "grad_norm" of all gradients, "grad_norm/<name>" of each parameter and
+// "grad_norm/<layer>" of the parameters of each layer, whose names have the
+// form "<layer>.<name>". If clipping is enabled, the norm of all clipped
+// gradients is recorded as "grad_norm_clipped".
+func (g *GradNorms) Clip(params []*Param, maxNorm, maxValue float64) {
+	g.metrics = Metrics{}
+	layers := Metrics{}
+	sum := 0.0
+	for _, p := range params {
+		norm := GradNorm([]*Param{p})
+		g.metrics[gradNormKey+"/"+p.Name] = norm
+		if i := strings.LastIndexByte(p.Name, '.'); i >= 0 {
+			layers[p.Name[:i]] += norm * norm
+		}
+		sum += norm * norm
+	}
+	for layer, s := range layers {
+		g.metrics[gradNormKey+"/"+layer] = math.Sqrt(s)
+	}
+	g.metrics[gradNormKey] = math.Sqrt(sum)
+
+	if maxNorm > 0 || maxValue > 0 {
+		ClipGradients(params, maxNorm, maxValue)
+		g.metrics[gradNormKey+"_clipped"] = GradNorm(params)
+	}
+}
+
+// Metrics returns the norms recorded by the last Clip, or nil if there was
+// none.
+func (g *GradNorms) Metrics() Metrics {
+	return g.metrics
+}
+
+// Optimizer represents an update rule of gradient-based training.
+// Optimizers keep per-parameter state (e.g. velocities) and export it in
+// their fields so that they can be saved by DumpOptimizer and restored to
+// resume training.
+type Optimizer interface {
+	// Name returns a name that identifies the update rule.
+	Name() string
+
+	// Update performs one descent step on p.Value using p.Grad.
+	Update(p *Param)
+
+	LearningRate() float64
+	SetLearningRate(rate float64)
+}
+
+// SGD is the plain stochastic gradient descent.
+type SGD struct {
+	Rate float64
+}
+
+// NewSGD returns a new SGD optimizer.
+func NewSGD(rate float64) *SGD {
+	return &SGD{Rate: rate}
+}
+
+func (o *SGD) Name() string                 { return "sgd" }
+func (o *SGD) LearningRate() float64        { return o.Rate }
+func (o *SGD) SetLearningRate(rate float64) { o.Rate = rate }
+
+func (o *SGD) Update(p *Param) {
+	Axpy(-o.Rate, p.Grad, p.Value)
+}
+
+// Momentum is SGD with classical or Nesterov momentum.
+type Momentum struct {
+	Rate     float64
+	Momentum float64
+	Nesterov bool
+	Velocity map[string][]float64
+}
+
+// NewMomentum returns a new optimizer with classical momentum.
+func NewMomentum(rate, momentum float64) *Momentum {
+	return &Momentum{Rate: rate, Momentum: momentum}
+}
+
+// NewNesterov returns a new optimizer with Nesterov accelerated gradient.
+func NewNesterov(rate, momentum float64) *Momentum {
+	return &Momentum{Rate: rate, Momentum: momentum, Nesterov: true}
+}
+
+func (o *Momentum) Name() string {
+	if o.Nesterov {
+		return "nesterov"
+	}
+	return "momentum"
+}
+
+func (o *Momentum) LearningRate() float64        { return o.Rate }
+func (o *Momentum) SetLearningRate(rate float64) { o.Rate = rate }
+
+func (o *Momentum) Update(p *Param) {
+	v := state(&o.Velocity, p)
+	for i, g := range p.Grad {
+		prev := v[i]
+		v[i] = o.Momentum*v[i] - o.Rate*g
+		if o.Nesterov {
+			p.Value[i] += -o.Momentum*prev + (1.0+o.Momentum)*v[i]
+		} else {
+			p.Value[i] += v[i]
+		}
+	}
+}
+
+// AdaGrad scales the learning rate of each parameter by the inverse square
+// root of the sum of its squared gradients.
+type AdaGrad struct {
+	Rate        float64
+	Epsilon     float64
+	Accumulator map[string][]float64
+}
+
+// NewAdaGrad returns a new AdaGrad optimizer.
+func NewAdaGrad(rate float64) *AdaGrad {
+	return &AdaGrad{Rate: rate, Epsilon: 1.0e-8}
+}
+
+func (o *AdaGrad) Name() string                 { return "adagrad" }
+func (o *AdaGrad) LearningRate() float64        { return o.Rate }
+func (o *AdaGrad) SetLearningRate(rate float64) { o.Rate = rate }
+
+func (o *AdaGrad) Update(p *Param) {
+	acc := state(&o.Accumulator, p)
+	for i, g := range p.Grad {
+		acc[i] += g * g
+		p.Value[i] -= o.Rate * g / (math.Sqrt(acc[i]) + o.Epsilon)
+	}
+}
+
+// RMSProp scales the learning rate of each parameter by the inverse square
+// root of a running average of its squared gradients.
+type RMSProp struct {
+	Rate       float64
+	Decay      float64
+	Epsilon    float64
+	MeanSquare map[string][]float64
+}
+
+// NewRMSProp returns a new RMSProp optimizer.
+func NewRMSProp(rate float64) *RMSProp {
+	return &RMSProp{Rate: rate, Decay: 0.9, Epsilon: 1.0e-8}
+}
+
+func (o *RMSProp) Name() string                 { return "rmsprop" }
+func (o *RMSProp) LearningRate() float64        { return o.Rate }
+func (o *RMSProp) SetLearningRate(rate float64) { o.Rate = rate }
+
+func (o *RMSProp) Update(p *Param) {
+	ms := state(&o.MeanSquare, p)
+	for i, g := range p.Grad {
+		ms[i] = o.Decay*ms[i] + (1.0-o.Decay)*g*g
+		p.Value[i] -= o.Rate * g / (math.Sqrt(ms[i]) + o.Epsilon)
+	}
+}
+
+// Adam is the adaptive moment estimation algorithm.
+// refs: D. Kingma and J. Ba, "Adam: A Method for Stochastic Optimization",
+// ICLR 2015.
+type Adam struct {
+	Rate    float64
+	Beta1   float64
+	Beta2   float64
+	Epsilon float64
+	M       map[string][]float64 // first moment estimates
+	V       map[string][]float64 // second moment estimates
+	Step    map[string]int
+}
+
+// NewAdam returns a new Adam optimizer with the default decay rates.
+func NewAdam(rate float64) *Adam {
+	return &Adam{Rate: rate, Beta1: 0.9, Beta2: 0.999, Epsilon: 1.0e-8}
+}
+
+func (o *Adam) Name() string                 { return "adam" }
+func (o *Adam) LearningRate() float64        { return o.Rate }
+func (o *Adam) SetLearningRate(rate float64) { o.Rate = rate }
+
+func (o *Adam) Update(p *Param) {
+	m := state(&o.M, p)
+	v := state(&o.V, p)
+	if o.Step == nil {
+		o.Step = make(map[string]int)
+	}
+	o.Step[p.Name]++
+	t := float64(o.Step[p.Name])
+	c1 := 1.0 - math.Pow(o.Beta1, t)
+	c2 := 1.0 - math.Pow(o.Beta2, t)
+
+	for i, g := range p.Grad {
+		m[i] = o.Beta1*m[i] + (1.0-o.Beta1)*g
+		v[i] = o.Beta2*v[i] + (1.0-o.Beta2)*g*g
+		p.Value[i] -= o.Rate * (m[i] / c1) / (math.Sqrt(v[i]/c2) + o.Epsilon)
+	}
+}
+
+// state returns the state vector of p in s, allocating it if needed.
+func state(s *map[string][]float64, p *Param) []float64 {
+	if *s == nil {
+		*s = make(map[string][]float64)
+	}
+	v, ok := (*s)[p.Name]
+	if !ok || len(v) != len(p.Value) {
+		v = make([]float64, len(p.Value))
+		(*s)[p.Name] = v
+	}
+	return v
+}
+
+// NewOptimizer returns a zero-state optimizer identified by name.
+func NewOptimizer(name string) (Optimizer, error) {
+	switch name {
+	case "sgd":
+		return &SGD{}, nil
+	case "momentum":
+		return &Momentum{}, nil
+	case "nesterov":
+		return &Momentum{Nesterov: true}, nil
+	case "adagrad":
+		return &AdaGrad{}, nil
+	case "rmsprop":
+		return &RMSProp{}, nil
+	case "adam":
+		return &Adam{}, nil
+	}
+	return nil, fmt.Errorf("nnet: unknown optimizer %q", name)
+}
+
+// optimizerJSON is the serialized form of an optimizer.
+type optimizerJSON struct {
+	Name  string
+	State json.RawMessage
+}
+
+// MarshalOptimizer returns the JSON encoding of an optimizer including its
+// configuration and per-parameter state.
+func MarshalOptimizer(o Optimizer) ([]byte, error) {
+	s, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(optimizerJSON{Name: o.Name(), State: s})
+}
+
+// UnmarshalOptimizer restores an optimizer encoded by MarshalOptimizer.
+func UnmarshalOptimizer(b []byte) (Optimizer, error) {
+	var oj optimizerJSON
+	if err := json.Unmarshal(b, &oj); err != nil {
+		return nil, err
+	}
+	o, err := NewOptimizer(oj.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(oj.State, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// DumpOptimizer writes an optimizer to file in json format.
+func DumpOptimizer(filename string, o Optimizer) error {
+	b, err := MarshalOptimizer(o)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(b)
+	return err
+}
+
+// LoadOptimizer loads an optimizer from a dump file.
+func LoadOptimizer(filename string) (Optimizer, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalOptimizer(b)
+}
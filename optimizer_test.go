@@ -0,0 +1,121 @@
+package nnet
+
+import (
+	"math"
+	"testing"
+)
+
+// minimize runs n steps of o on f(x) = 0.5*||x - 3||^2 starting at zero.
+func minimize(o Optimizer, x []float64, n int) {
+	p := &Param{Name: "x", Value: x, Grad: make([]float64, len(x))}
+	for i := 0; i < n; i++ {
+		for j := range x {
+			p.Grad[j] = x[j] - 3.0
+		}
+		o.Update(p)
+	}
+}
+
+func TestOptimizers(t *testing.T) {
+	optimizers := []Optimizer{
+		NewSGD(0.1), NewMomentum(0.1, 0.5), NewNesterov(0.1, 0.5),
+		NewAdaGrad(1.0), NewRMSProp(0.05), NewAdam(0.1),
+	}
+	for _, o := range optimizers {
+		x := make([]float64, 2)
+		minimize(o, x, 500)
+		for _, v := range x {
+			if math.Abs(v-3.0) > 1.0e-2 {
+				t.Errorf("%s converges to %v, want 3.", o.Name(), x)
+				break
+			}
+		}
+	}
+}
+
+func TestMarshalOptimizer(t *testing.T) {
+	o := NewAdam(0.01)
+	x := make([]float64, 3)
+	minimize(o, x, 10)
+
+	b, err := MarshalOptimizer(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := UnmarshalOptimizer(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Resumed optimizer must continue exactly as the original one.
+	y := append([]float64(nil), x...)
+	minimize(o, x, 10)
+	minimize(restored, y, 10)
+	for i := range x {
+		if x[i] != y[i] {
+			t.Errorf("Resumed optimizer reaches %v, want %v.", y, x)
+			break
+		}
+	}
+}
+
+func TestClipGradients(t *testing.T) {
+	params := []*Param{
+		{Name: "a", Grad: []float64{3, -10}},
+		{Name: "b", Grad: []float64{4}},
+	}
+	ClipGradients(params, 0, 4)
+	if params[0].Grad[1] != -4 || params[0].Grad[0] != 3 {
+		t.Errorf("Clipping by value returns %v, want [3 -4].", params[0].Grad)
+	}
+
+	// norm is sqrt(9 + 16 + 16) before clipping by norm
+	ClipGradients(params, 1, 0)
+	if norm := GradNorm(params); math.Abs(norm-1) > 1.0e-12 {
+		t.Errorf("GradNorm returns %v after clipping, want 1.", norm)
+	}
+	want := 3 / math.Sqrt(41)
+	if math.Abs(params[0].Grad[0]-want) > 1.0e-12 {
+		t.Errorf("Clipping by norm returns %v, want %v.", params[0].Grad[0], want)
+	}
+
+	// gradients within the limits are unchanged
+	ClipGradients(params, 2, 1)
+	if math.Abs(params[0].Grad[0]-want) > 1.0e-12 {
+		t.Errorf("Clipping changes %v, want %v.", params[0].Grad[0], want)
+	}
+}
+
+func TestGradNormsClip(t *testing.T) {
+	params := []*Param{
+		{Name: "layer0.W", Grad: []float64{3, 0}},
+		{Name: "layer0.B", Grad: []float64{4}},
+		{Name: "layer1.W", Grad: []float64{0, 12}},
+	}
+	var g GradNorms
+	g.Clip(params, 1.0e-3, 0)
+	want := Metrics{
+		"grad_norm":          13,
+		"grad_norm/layer0":   5,
+		"grad_norm/layer0.W": 3,
+		"grad_norm/layer0.B": 4,
+		"grad_norm/layer1":   12,
+		"grad_norm/layer1.W": 12,
+		"grad_norm_clipped":  1.0e-3,
+	}
+	metrics := g.Metrics()
+	if len(metrics) != len(want) {
+		t.Errorf("Clip records %v, want %v.", metrics, want)
+	}
+	for k, v := range want {
+		if math.Abs(metrics[k]-v) > 1.0e-12 {
+			t.Errorf("Clip records %s=%v, want %v.", k, metrics[k], v)
+		}
+	}
+
+	// without clipping, only the norms of the gradients are recorded
+	g.Clip(params, 0, 0)
+	if _, ok := g.Metrics()["grad_norm_clipped"]; ok {
+		t.Errorf("Clip records grad_norm_clipped without clipping.")
+	}
+}
@@ -0,0 +1,44 @@
+package nnet
+
+import (
+	"sync"
+)
+
+// NumChunks returns the number of chunks that ParallelFor splits n items
+// into for the given number of workers.
+func NumChunks(n, numWorkers int) int {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	if numWorkers > n {
+		numWorkers = n
+	}
+	if numWorkers < 1 {
+		return 1
+	}
+	return numWorkers
+}
+
+// ParallelFor splits [0, n) into NumChunks(n, numWorkers) contiguous chunks
+// and calls f(chunk, begin, end) for each of them on its own goroutine.
+// It returns when all calls have finished. The chunks depend only on n and
+// numWorkers, so callers that reduce per-chunk results in chunk order get
+// reproducible results. If there is only one chunk, f is called on the
+// current goroutine.
+func ParallelFor(n, numWorkers int, f func(chunk, begin, end int)) {
+	numChunks := NumChunks(n, numWorkers)
+	if numChunks == 1 {
+		f(0, 0, n)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(numChunks)
+	for c := 0; c < numChunks; c++ {
+		go func(c int) {
+			defer wg.Done()
+			f(c, c*n/numChunks, (c+1)*n/numChunks)
+		}(c)
+	}
+	wg.Wait()
+}
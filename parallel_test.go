@@ -0,0 +1,33 @@
+package nnet
+
+import (
+	"testing"
+)
+
+func TestParallelFor(t *testing.T) {
+	for _, n := range []int{0, 1, 7, 100} {
+		for _, numWorkers := range []int{0, 1, 3, 16} {
+			visited := make([]int, n)
+			chunks := make([]int, NumChunks(n, numWorkers))
+			ParallelFor(n, numWorkers, func(c, b, e int) {
+				chunks[c]++
+				for i := b; i < e; i++ {
+					visited[i]++
+				}
+			})
+
+			for c, count := range chunks {
+				if count != 1 {
+					t.Errorf("ParallelFor(%d, %d) calls chunk %d %d times, want 1.",
+						n, numWorkers, c, count)
+				}
+			}
+			for i, count := range visited {
+				if count != 1 {
+					t.Errorf("ParallelFor(%d, %d) visits %d %d times, want 1.",
+						n, numWorkers, i, count)
+				}
+			}
+		}
+	}
+}
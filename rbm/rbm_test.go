@@ -1,27 +1,26 @@
 package rbm
 
 import (
+	"github.com/r9y9/nnet"
 	"math"
 	"math/rand"
+	"path/filepath"
 	"testing"
-	"time"
 )
 
-func createDummyData(size int) [][]float64 {
-	rand.Seed(time.Now().UnixNano())
+func createDummyData(size int, rng *rand.Rand) [][]float64 {
 	data := make([][]float64, size)
 	for i := 0; i < size/2; i++ {
 		sample := make([]float64, 2)
-		sample[0] = math.Abs(rand.NormFloat64()*0.1 + 0.1)
-		sample[1] = math.Abs(rand.NormFloat64()*0.1 + 0.1)
+		sample[0] = math.Abs(rng.NormFloat64()*0.1 + 0.1)
+		sample[1] = math.Abs(rng.NormFloat64()*0.1 + 0.1)
 		data[i] = sample
 	}
-	rand.Seed(time.Now().UnixNano())
 
 	for i := size / 2; i < size; i++ {
 		sample := make([]float64, 2)
-		sample[0] = rand.NormFloat64()*0.1 + 0.7
-		sample[1] = rand.NormFloat64()*0.1 + 0.7
+		sample[0] = rng.NormFloat64()*0.1 + 0.7
+		sample[1] = rng.NormFloat64()*0.1 + 0.7
 
 		data[i] = sample
 	}
@@ -30,12 +29,12 @@ func createDummyData(size int) [][]float64 {
 }
 
 func TestRBM(t *testing.T) {
-	data := createDummyData(1000)
+	data := createDummyData(1000, nnet.DefaultRand(nil))
 
 	// RBM Training
 	numVisibleUnits := 2
 	numHiddenUnits := 2
-	r := New(numVisibleUnits, numHiddenUnits)
+	r := New(numVisibleUnits, numHiddenUnits, nil, nil)
 	option := TrainingOption{
 		LearningRate:         0.1,
 		Epoches:              1000,
@@ -53,12 +52,12 @@ func TestRBM(t *testing.T) {
 }
 
 func BenchmarkRBM(b *testing.B) {
-	data := createDummyData(1000)
+	data := createDummyData(1000, nnet.DefaultRand(nil))
 
 	// RBM Training
 	numVisibleUnits := 2
 	numHiddenUnits := 2
-	r := New(numVisibleUnits, numHiddenUnits)
+	r := New(numVisibleUnits, numHiddenUnits, nil, nil)
 	option := TrainingOption{
 		LearningRate:         0.1,
 		Epoches:              10,
@@ -73,3 +72,120 @@ func BenchmarkRBM(b *testing.B) {
 		r.Train(data, option)
 	}
 }
+
+func TestRBMReproducible(t *testing.T) {
+	for _, numWorkers := range []int{1, 4} {
+		option := TrainingOption{
+			LearningRate:         0.1,
+			Epoches:              5,
+			OrderOfGibbsSampling: 1,
+			UsePersistent:        true,
+			MiniBatchSize:        20,
+			NumWorkers:           numWorkers,
+		}
+
+		var models [2]*RBM
+		for i := range models {
+			data := createDummyData(100, nnet.NewRand(1))
+			models[i] = New(2, 3, nil, nnet.NewRand(2))
+			if err := models[i].Train(data, option); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for i := range models[0].W.Data {
+			if models[0].W.Data[i] != models[1].W.Data[i] {
+				t.Fatalf("Weights differ with the same seed and %d workers: %v and %v.",
+					numWorkers, models[0].W.Data, models[1].W.Data)
+			}
+		}
+	}
+}
+
+func TestRBMCallbacksDontChangeTraining(t *testing.T) {
+	option := TrainingOption{
+		LearningRate:         0.1,
+		Epoches:              5,
+		OrderOfGibbsSampling: 1,
+		MiniBatchSize:        20,
+	}
+	var models [2]*RBM
+	for i := range models {
+		if i == 1 {
+			option.Callbacks = []nnet.Callback{nnet.BaseCallback{}}
+		}
+		data := createDummyData(100, nnet.NewRand(1))
+		models[i] = New(2, 3, nil, nnet.NewRand(2))
+		if err := models[i].Train(data, option); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := range models[0].W.Data {
+		if models[0].W.Data[i] != models[1].W.Data[i] {
+			t.Fatalf("Weights differ with a callback: %v and %v.",
+				models[0].W.Data, models[1].W.Data)
+		}
+	}
+}
+
+func TestRBMResume(t *testing.T) {
+	dir := t.TempDir()
+	train := func(epoches int, checkpoint string) *RBM {
+		r := New(2, 3, nil, nnet.NewRand(2))
+		option := TrainingOption{
+			LearningRate:         0.1,
+			Epoches:              epoches,
+			OrderOfGibbsSampling: 1,
+			UsePersistent:        true,
+			MiniBatchSize:        20,
+			Optimizer:            nnet.NewMomentum(0.1, 0.5),
+			Schedule:             &nnet.ReduceOnPlateau{Rate: 0.1, Factor: 0.5, Maximize: true},
+			Checkpoint:           checkpoint,
+		}
+		if err := r.Train(createDummyData(100, nnet.NewRand(1)), option); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	want := train(4, filepath.Join(dir, "full.json"))
+
+	// Interrupted after two epochs and resumed by a fresh model
+	checkpoint := filepath.Join(dir, "interrupted.json")
+	train(2, checkpoint)
+	r := New(2, 3, nil, nil)
+	option := TrainingOption{
+		LearningRate:         0.1,
+		Epoches:              4,
+		OrderOfGibbsSampling: 1,
+		UsePersistent:        true,
+		MiniBatchSize:        20,
+		Schedule:             &nnet.ReduceOnPlateau{Rate: 0.1, Factor: 0.5, Maximize: true},
+		Checkpoint:           checkpoint,
+	}
+	if err := r.Resume(checkpoint, createDummyData(100, nnet.NewRand(1)), option); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range want.W.Data {
+		if r.W.Data[i] != want.W.Data[i] {
+			t.Fatalf("Resumed weights are %v, want %v.", r.W.Data, want.W.Data)
+		}
+	}
+}
+
+func TestLoadBaselineDump(t *testing.T) {
+	// Written by Dump of the first version, with weights as arrays of rows
+	// and gradients.
+	r, err := Load(filepath.Join("testdata", "baseline.json"))
+	if err != nil {
+		t.Fatalf("Load returns %v, want nil.", err)
+	}
+	want := []float64{0.5305935354751656, 0.5177489623689804}
+	for i, h := range r.Forward([]float64{1, 0, 1}) {
+		if math.Abs(h-want[i]) > 1.0e-12 {
+			t.Errorf("Forward returns %v at %d, want %v.", h, i, want[i])
+		}
+	}
+}
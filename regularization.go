@@ -0,0 +1,142 @@
+package nnet
+
+import (
+	"math"
+	"strings"
+)
+
+// Regularizer penalizes or constrains a parameter. L1 and L2 are added to
+// the objective, so that their gradients are added to the gradient of the
+// parameter before the optimizer applies it; together they make the
+// elastic net. WeightDecay and MaxNorm are applied to the parameter after
+// each update instead.
+type Regularizer struct {
+	L1 float64 // coefficient of the sum of absolute values
+	L2 float64 // coefficient of half the sum of squares
+
+	// WeightDecay shrinks the parameter by 1 - learning rate * WeightDecay
+	// after each update, independently of the optimizer.
+	// refs: I. Loshchilov and F. Hutter, "Decoupled Weight Decay
+	// Regularization", ICLR 2019.
+	WeightDecay float64
+
+	// MaxNorm is the maximum L2 norm of the weights of each unit of a
+	// weight matrix, 0 disables. Weights of units with a larger norm are
+	// rescaled to MaxNorm.
+	MaxNorm float64
+}
+
+// Regularization assigns a regularizer to each parameter of a model. The
+// zero value and nil don't regularize.
+type Regularization struct {
+	Weights Regularizer // of weight matrices, see Param
+	Biases  Regularizer // of parameters other than weight matrices
+
+	// Params overrides Weights and Biases for the parameter named by the
+	// key, e.g. "W" in rbm or "layer1.B" in mlp, and Weights for all
+	// weight matrices of a layer named by the key, e.g. "layer1" in mlp.
+	Params map[string]Regularizer
+}
+
+// For returns the regularizer of p.
+func (r *Regularization) For(p *Param) Regularizer {
+	if r == nil {
+		return Regularizer{}
+	}
+	if reg, ok := r.Params[p.Name]; ok {
+		return reg
+	}
+	if p.Rows == 0 {
+		return r.Biases
+	}
+	if i := strings.LastIndexByte(p.Name, '.'); i >= 0 {
+		if reg, ok := r.Params[p.Name[:i]]; ok {
+			return reg
+		}
+	}
+	return r.Weights
+}
+
+// Penalty returns the sum of the L1 and L2 terms of params.
+func (r *Regularization) Penalty(params []*Param) float64 {
+	if r == nil {
+		return 0
+	}
+	sum := 0.0
+	for _, p := range params {
+		reg := r.For(p)
+		for _, w := range p.Value {
+			sum += reg.L1*math.Abs(w) + 0.5*reg.L2*w*w
+		}
+	}
+	return sum
+}
+
+// AddGradients adds the gradients of Penalty to the gradients of params.
+func (r *Regularization) AddGradients(params []*Param) {
+	if r == nil {
+		return
+	}
+	for _, p := range params {
+		reg := r.For(p)
+		if reg.L1 == 0 && reg.L2 == 0 {
+			continue
+		}
+		for i, w := range p.Value {
+			sign := 0.0
+			if w > 0 {
+				sign = 1.0
+			} else if w < 0 {
+				sign = -1.0
+			}
+			p.Grad[i] += reg.L1*sign + reg.L2*w
+		}
+	}
+}
+
+// Constrain applies weight decay with the given learning rate and max-norm
+// constraints to params. It is called after each update.
+func (r *Regularization) Constrain(params []*Param, learningRate float64) {
+	if r == nil {
+		return
+	}
+	for _, p := range params {
+		reg := r.For(p)
+		if reg.WeightDecay != 0 {
+			scale := 1.0 - learningRate*reg.WeightDecay
+			for i := range p.Value {
+				p.Value[i] *= scale
+			}
+		}
+		if reg.MaxNorm > 0 && p.Rows > 0 {
+			maxNorm(p, reg.MaxNorm)
+		}
+	}
+}
+
+// maxNorm rescales the weights of each unit of p to at most max.
+func maxNorm(p *Param, max float64) {
+	units, size := p.Cols, p.Rows
+	if p.UnitsInRows {
+		units, size = p.Rows, p.Cols
+	}
+	// index returns the index of the i-th weight of unit j
+	index := func(j, i int) int {
+		if p.UnitsInRows {
+			return j*p.Cols + i
+		}
+		return i*p.Cols + j
+	}
+	for j := 0; j < units; j++ {
+		sum := 0.0
+		for i := 0; i < size; i++ {
+			w := p.Value[index(j, i)]
+			sum += w * w
+		}
+		if norm := math.Sqrt(sum); norm > max {
+			for i := 0; i < size; i++ {
+				p.Value[index(j, i)] *= max / norm
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package nnet
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRegularizationFor(t *testing.T) {
+	r := &Regularization{
+		Weights: Regularizer{L2: 1},
+		Biases:  Regularizer{L2: 2},
+		Params: map[string]Regularizer{
+			"layer1":   {L2: 3},
+			"layer1.B": {L2: 4},
+		},
+	}
+	for _, c := range []struct {
+		p    *Param
+		want float64
+	}{
+		{&Param{Name: "layer0.W", Rows: 2, Cols: 2}, 1},
+		{&Param{Name: "layer0.B"}, 2},
+		{&Param{Name: "layer1.W", Rows: 2, Cols: 2}, 3},
+		{&Param{Name: "layer1.B"}, 4},
+		{&Param{Name: "layer1.gamma"}, 2},
+	} {
+		if got := r.For(c.p).L2; got != c.want {
+			t.Errorf("L2 of %s is %v, want %v.", c.p.Name, got, c.want)
+		}
+	}
+	var none *Regularization
+	if none.For(&Param{Rows: 1, Cols: 1}) != (Regularizer{}) {
+		t.Errorf("nil regularization has a regularizer.")
+	}
+}
+
+func TestRegularizationGradients(t *testing.T) {
+	// Elastic net
+	r := &Regularization{Weights: Regularizer{L1: 0.3, L2: 0.5}}
+	p := &Param{Name: "W", Value: []float64{0.7, -1.2, 2.5, -0.1},
+		Grad: make([]float64, 4), Rows: 2, Cols: 2}
+	r.AddGradients([]*Param{p})
+
+	const epsilon = 1.0e-6
+	for i, x := range p.Value {
+		p.Value[i] = x + epsilon
+		plus := r.Penalty([]*Param{p})
+		p.Value[i] = x - epsilon
+		minus := r.Penalty([]*Param{p})
+		p.Value[i] = x
+		if n := (plus - minus) / (2 * epsilon); math.Abs(p.Grad[i]-n) > 1.0e-6 {
+			t.Errorf("Gradient of penalty at %d is %v, want %v.", i,
+				p.Grad[i], n)
+		}
+	}
+}
+
+func TestRegularizationConstrain(t *testing.T) {
+	r := &Regularization{
+		Weights: Regularizer{WeightDecay: 0.5},
+		Params:  map[string]Regularizer{"V": {MaxNorm: 1}},
+	}
+	w := &Param{Name: "W", Value: []float64{1, 2}, Rows: 1, Cols: 2}
+	b := &Param{Name: "B", Value: []float64{1, 2}}
+	r.Constrain([]*Param{w, b}, 0.1)
+	if w.Value[0] != 0.95 || w.Value[1] != 1.9 {
+		t.Errorf("Decayed weights are %v, want [0.95 1.9].", w.Value)
+	}
+	if b.Value[0] != 1 || b.Value[1] != 2 {
+		t.Errorf("Biases are decayed to %v.", b.Value)
+	}
+
+	// Units in columns, then in rows
+	for _, c := range []struct {
+		unitsInRows bool
+		want        []float64
+	}{
+		{false, []float64{0.6, 0.5, 0.8, 0.5}},
+		{true, []float64{0.6, 0.8, 0.5, 0.5}},
+	} {
+		v := &Param{Name: "V", Value: []float64{3, 0.5, 4, 0.5}, Rows: 2,
+			Cols: 2, UnitsInRows: c.unitsInRows}
+		if c.unitsInRows {
+			v.Value = []float64{3, 4, 0.5, 0.5}
+		}
+		r.Constrain([]*Param{v}, 0.1)
+		for i := range v.Value {
+			if math.Abs(v.Value[i]-c.want[i]) > 1.0e-12 {
+				t.Errorf("Max-norm weights are %v, want %v.", v.Value, c.want)
+				break
+			}
+		}
+	}
+}
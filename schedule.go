@@ -0,0 +1,171 @@
+package nnet
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// Schedule determines the learning rate during training. nnet.Trainer
+// consults it before every mini-batch.
+type Schedule interface {
+	// LearningRate returns the learning rate for the given (zero-based)
+	// epoch and iteration, the number of mini-batches processed so far.
+	LearningRate(epoch, iteration int) float64
+}
+
+// ObjectiveObserver is implemented by schedules that adapt to the
+// monitored objective. nnet.Trainer calls ObserveObjective at the end of
+// every epoch.
+type ObjectiveObserver interface {
+	ObserveObjective(epoch int, objective float64)
+}
+
+// LearningRateSetter is implemented by models whose learning rate can be
+// controlled by a Schedule.
+type LearningRateSetter interface {
+	SetLearningRate(rate float64)
+}
+
+// Constant keeps the learning rate fixed.
+type Constant struct {
+	Rate float64
+}
+
+func (s *Constant) LearningRate(epoch, iteration int) float64 {
+	return s.Rate
+}
+
+// StepDecay multiplies the learning rate by Factor every StepSize epochs.
+type StepDecay struct {
+	Initial  float64
+	Factor   float64
+	StepSize int
+}
+
+func (s *StepDecay) LearningRate(epoch, iteration int) float64 {
+	if s.StepSize <= 0 {
+		return s.Initial
+	}
+	return s.Initial * math.Pow(s.Factor, float64(epoch/s.StepSize))
+}
+
+// ExponentialDecay multiplies the learning rate by Decay every epoch.
+type ExponentialDecay struct {
+	Initial float64
+	Decay   float64
+}
+
+func (s *ExponentialDecay) LearningRate(epoch, iteration int) float64 {
+	return s.Initial * math.Pow(s.Decay, float64(epoch))
+}
+
+// CosineAnnealing decreases the learning rate from Initial to Min following
+// a half cosine over Epoches epochs and keeps Min afterwards.
+// refs: I. Loshchilov and F. Hutter, "SGDR: Stochastic Gradient Descent
+// with Warm Restarts", ICLR 2017.
+type CosineAnnealing struct {
+	Initial float64
+	Min     float64
+	Epoches int
+}
+
+func (s *CosineAnnealing) LearningRate(epoch, iteration int) float64 {
+	if s.Epoches <= 0 || epoch >= s.Epoches {
+		return s.Min
+	}
+	progress := float64(epoch) / float64(s.Epoches)
+	return s.Min + 0.5*(s.Initial-s.Min)*(1.0+math.Cos(math.Pi*progress))
+}
+
+// LinearWarmup increases the learning rate linearly during the first Steps
+// iterations up to the rate given by Schedule, which is used afterwards.
+type LinearWarmup struct {
+	Steps    int
+	Schedule Schedule
+}
+
+func (s *LinearWarmup) LearningRate(epoch, iteration int) float64 {
+	rate := s.Schedule.LearningRate(epoch, iteration)
+	if iteration < s.Steps {
+		return rate * float64(iteration+1) / float64(s.Steps)
+	}
+	return rate
+}
+
+// ObserveObjective passes the objective to Schedule if it adapts to it.
+func (s *LinearWarmup) ObserveObjective(epoch int, objective float64) {
+	if observer, ok := s.Schedule.(ObjectiveObserver); ok {
+		observer.ObserveObjective(epoch, objective)
+	}
+}
+
+// ReduceOnPlateau multiplies the learning rate by Factor when the monitored
+// objective has not improved for Patience epochs. The objective is
+// minimized unless Maximize is set (e.g. for the pseudo log-likelihood of
+// RBMs).
+type ReduceOnPlateau struct {
+	Rate      float64
+	Factor    float64
+	Patience  int
+	MinRate   float64
+	Threshold float64 // minimum change to count as improvement
+	Maximize  bool
+
+	best float64
+	wait int
+	seen bool
+}
+
+func (s *ReduceOnPlateau) LearningRate(epoch, iteration int) float64 {
+	return s.Rate
+}
+
+func (s *ReduceOnPlateau) ObserveObjective(epoch int, objective float64) {
+	if !s.seen || s.improved(objective) {
+		s.best = objective
+		s.wait = 0
+		s.seen = true
+		return
+	}
+
+	s.wait++
+	if s.wait >= s.Patience {
+		s.Rate = math.Max(s.Rate*s.Factor, s.MinRate)
+		s.wait = 0
+	}
+}
+
+// reduceOnPlateau has the same fields as ReduceOnPlateau but no JSON
+// methods.
+type reduceOnPlateau ReduceOnPlateau
+
+type reduceOnPlateauJSON struct {
+	*reduceOnPlateau
+	Best float64
+	Wait int
+	Seen bool
+}
+
+// MarshalJSON implements json.Marshaler. The state of the plateau
+// detection is included so that it can be restored from checkpoints.
+func (s *ReduceOnPlateau) MarshalJSON() ([]byte, error) {
+	return json.Marshal(reduceOnPlateauJSON{(*reduceOnPlateau)(s),
+		s.best, s.wait, s.seen})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *ReduceOnPlateau) UnmarshalJSON(b []byte) error {
+	aux := reduceOnPlateauJSON{reduceOnPlateau: (*reduceOnPlateau)(s)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	s.best, s.wait, s.seen = aux.Best, aux.Wait, aux.Seen
+	return nil
+}
+
+func (s *ReduceOnPlateau) improved(objective float64) bool {
+	if s.Maximize {
+		return objective > s.best+s.Threshold
+	}
+	return objective < s.best-s.Threshold
+}
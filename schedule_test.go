@@ -0,0 +1,86 @@
+package nnet
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSchedules(t *testing.T) {
+	tests := []struct {
+		schedule         Schedule
+		epoch, iteration int
+		want             float64
+	}{
+		{&StepDecay{Initial: 1.0, Factor: 0.5, StepSize: 2}, 5, 0, 0.25},
+		{&ExponentialDecay{Initial: 1.0, Decay: 0.9}, 2, 0, 0.81},
+		{&CosineAnnealing{Initial: 1.0, Min: 0.0, Epoches: 10}, 5, 0, 0.5},
+		{&CosineAnnealing{Initial: 1.0, Min: 0.1, Epoches: 10}, 20, 0, 0.1},
+		{&LinearWarmup{Steps: 4, Schedule: &Constant{Rate: 0.4}}, 0, 1, 0.2},
+		{&LinearWarmup{Steps: 4, Schedule: &Constant{Rate: 0.4}}, 3, 100, 0.4},
+	}
+	for _, test := range tests {
+		rate := test.schedule.LearningRate(test.epoch, test.iteration)
+		if math.Abs(rate-test.want) > 1.0e-12 {
+			t.Errorf("%T returns %f, want %f.", test.schedule, rate, test.want)
+		}
+	}
+}
+
+func TestReduceOnPlateau(t *testing.T) {
+	s := &ReduceOnPlateau{Rate: 1.0, Factor: 0.5, Patience: 2, MinRate: 0.2}
+	// reduced after the 4th, 6th and 8th epochs, but bounded by MinRate
+	want := []float64{1, 1, 1, 0.5, 0.5, 0.25, 0.25, 0.2}
+	for epoch, objective := range []float64{3, 2, 2, 2, 2, 2, 2, 2} {
+		s.ObserveObjective(epoch, objective)
+		if s.LearningRate(epoch+1, 0) != want[epoch] {
+			t.Errorf("Learning rate after epoch %d %f, want %f.",
+				epoch, s.LearningRate(epoch+1, 0), want[epoch])
+		}
+	}
+}
+
+func TestLinearWarmupObserveObjective(t *testing.T) {
+	s := &LinearWarmup{Steps: 4, Schedule: &ReduceOnPlateau{Rate: 1.0,
+		Factor: 0.5, Patience: 1}}
+	for epoch, objective := range []float64{3, 3} {
+		s.ObserveObjective(epoch, objective)
+	}
+	if s.LearningRate(2, 100) != 0.5 {
+		t.Errorf("Learning rate %f, want 0.5.", s.LearningRate(2, 100))
+	}
+}
+
+type scheduledModel struct {
+	rates []float64
+}
+
+func (m *scheduledModel) SetLearningRate(rate float64) {
+	m.rates = append(m.rates, rate)
+}
+
+func (m *scheduledModel) UnSupervisedMiniBatchUpdate(input [][]float64,
+	epoch, miniBatchIndex int) {
+}
+
+func (m *scheduledModel) UnSupervisedObjective(input [][]float64) float64 {
+	return 0
+}
+
+func TestTrainerSchedule(t *testing.T) {
+	m := &scheduledModel{}
+	trainer := NewTrainer(BaseTrainingOption{
+		Epoches:       3,
+		MiniBatchSize: 2,
+		Schedule:      &StepDecay{Initial: 1.0, Factor: 0.1, StepSize: 1},
+	})
+	if err := trainer.UnSupervisedMiniBatchTrain(m, MakeMatrix(4, 1)); err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{1, 1, 0.1, 0.1, 0.01, 0.01}
+	for i := range want {
+		if math.Abs(m.rates[i]-want[i]) > 1.0e-12 {
+			t.Errorf("Learning rates %v, want %v.", m.rates, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package nnet
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrShapeMismatch matches every *ShapeError in errors.Is.
+var ErrShapeMismatch = errors.New("nnet: shape mismatch")
+
+// ShapeError reports data or a layer whose size doesn't match the size
+// expected by a model.
+type ShapeError struct {
+	What     string // e.g. "input 3" or "layer 1 input units"
+	Expected int
+	Actual   int
+}
+
+func (e *ShapeError) Error() string {
+	return fmt.Sprintf("nnet: %s has size %d, want %d", e.What, e.Actual,
+		e.Expected)
+}
+
+// Is reports whether target is ErrShapeMismatch.
+func (e *ShapeError) Is(target error) bool {
+	return target == ErrShapeMismatch
+}
+
+// CheckSize returns a *ShapeError if actual differs from expected.
+func CheckSize(what string, expected, actual int) error {
+	if actual != expected {
+		return &ShapeError{What: what, Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+// CheckRows returns a *ShapeError for the first row of data whose length
+// differs from expected. Rows are described as what followed by the index.
+func CheckRows(what string, data [][]float64, expected int) error {
+	for i, row := range data {
+		if len(row) != expected {
+			return &ShapeError{What: fmt.Sprintf("%s %d", what, i),
+				Expected: expected, Actual: len(row)}
+		}
+	}
+	return nil
+}
+
+// ShapeValidator is implemented by models that check the shapes of data
+// before training on it. target is nil for unsupervised training.
+type ShapeValidator interface {
+	ValidateShape(input, target [][]float64) error
+}
+
+// Validator is implemented by models that check the consistency of their
+// parameters, e.g. after decoding a model file.
+type Validator interface {
+	Validate() error
+}
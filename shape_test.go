@@ -0,0 +1,67 @@
+package nnet
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestShapeError(t *testing.T) {
+	if err := CheckRows("input", [][]float64{{0, 1}, {2, 3}}, 2); err != nil {
+		t.Errorf("CheckRows returns %v, want no error.", err)
+	}
+
+	err := fmt.Errorf("wrapped: %w",
+		CheckRows("input", [][]float64{{0, 1}, {2}}, 2))
+	if !errors.Is(err, ErrShapeMismatch) {
+		t.Errorf("%v is not ErrShapeMismatch.", err)
+	}
+	var shapeErr *ShapeError
+	if !errors.As(err, &shapeErr) {
+		t.Fatalf("%v is not a *ShapeError.", err)
+	}
+	want := ShapeError{What: "input 1", Expected: 2, Actual: 1}
+	if *shapeErr != want {
+		t.Errorf("CheckRows returns %+v, want %+v.", *shapeErr, want)
+	}
+}
+
+// shapedModel accepts inputs of length one.
+type shapedModel struct {
+	scheduledModel
+	updates int
+}
+
+func (m *shapedModel) UnSupervisedMiniBatchUpdate(input [][]float64,
+	epoch, miniBatchIndex int) {
+	m.updates++
+}
+
+func (m *shapedModel) ValidateShape(input, target [][]float64) error {
+	return CheckRows("input", input, 1)
+}
+
+func TestTrainerValidatesShapes(t *testing.T) {
+	input := [][]float64{{0}, {1}, {2, 3}}
+	trainer := NewTrainer(BaseTrainingOption{Epoches: 1, MiniBatchSize: 1})
+
+	// In-memory data is rejected before any update
+	m := &shapedModel{}
+	err := trainer.UnSupervisedMiniBatchTrain(m, input)
+	if !errors.Is(err, ErrShapeMismatch) || m.updates != 0 {
+		t.Errorf("Training returns %v after %d updates, want a shape error "+
+			"before updates.", err, m.updates)
+	}
+
+	// Other datasets are checked per mini-batch
+	data := &Lazy{N: len(input), Load: func(i int) ([]float64, []float64,
+		error) {
+		return input[i], nil, nil
+	}}
+	m = &shapedModel{}
+	err = trainer.UnSupervisedMiniBatchTrainDataset(m, data)
+	if !errors.Is(err, ErrShapeMismatch) || m.updates != 2 {
+		t.Errorf("Training returns %v after %d updates, want a shape error "+
+			"after 2 updates.", err, m.updates)
+	}
+}
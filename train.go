@@ -1,8 +1,10 @@
 package nnet
 
 import (
+	"context"
 	"errors"
-	"fmt"
+	"math"
+	"os"
 )
 
 // SupervisedObjecitiver is an interface to provide objective function
@@ -39,13 +41,37 @@ type UnSupervisedMiniBatchUpdater interface {
 }
 
 type Trainer struct {
-	Option BaseTrainingOption
+	Option  BaseTrainingOption
+	resumed *checkpoint // set by Resume
 }
 
 type BaseTrainingOption struct {
 	Epoches       int
-	MiniBatchSize int // not used in standerd sgd
-	Monitoring    bool
+	MiniBatchSize int        // not used in standerd sgd
+	Shuffle       bool       // visits data in a different order every epoch
+	Seed          int64      // seed of the order of shuffled data
+	DropRemainder bool       // skips the last batch if it is smaller
+	Monitoring    bool       // prints the objective and gradient norms by Printer
+	Schedule      Schedule   // learning rate is left untouched if nil
+	Callbacks     []Callback // called in order
+
+	// Held-out data scored by ValidationMetric at the end of every epoch.
+	// The parameters with the best score are restored after training.
+	// ValidationTarget is not used in unsupervised training.
+	ValidationInput  [][]float64
+	ValidationTarget [][]float64
+	ValidationMetric Metric // Objective if nil
+
+	// Patience is the number of epochs without improvement of the
+	// validation score after which training stops. Zero disables early
+	// stopping.
+	Patience int
+
+	// Checkpoint is the file to which the training state is written every
+	// CheckpointEvery (default 1) epochs. The model must implement
+	// Checkpointer. Use Resume to continue training from the file.
+	Checkpoint      string
+	CheckpointEvery int
 }
 
 // New creates a new instance from training option.
@@ -68,60 +94,517 @@ func (t *Trainer) ParseTrainingOption(option BaseTrainingOption) error {
 	return nil
 }
 
-func (s *Trainer) SupervisedOnlineTrain(u SupervisedOnlineUpdater,
-	input, target [][]float64) error {
-	for epoch := 0; epoch < s.Option.Epoches; epoch++ {
-		for m := 0; m < len(input); m++ {
-			u.SupervisedOnlineUpdate(input[m], target[m])
+// updateLearningRate consults the schedule before an update.
+func (s *Trainer) updateLearningRate(u interface{}, epoch, iteration int) {
+	if s.Option.Schedule == nil {
+		return
+	}
+	u.(LearningRateSetter).SetLearningRate(
+		s.Option.Schedule.LearningRate(epoch, iteration))
+}
+
+// checkSchedule returns an error if the schedule can't control u.
+func (s *Trainer) checkSchedule(u interface{}) error {
+	if s.Option.Schedule == nil {
+		return nil
+	}
+	if _, ok := u.(LearningRateSetter); !ok {
+		return errors.New("Learning rate of the model can't be scheduled.")
+	}
+	return nil
+}
+
+// learningRater is implemented by models that report their learning rate.
+type learningRater interface {
+	LearningRate() float64
+}
+
+// callbacks returns the callbacks including the one for Monitoring.
+func (s *Trainer) callbacks() Callbacks {
+	callbacks := Callbacks(s.Option.Callbacks)
+	if s.Option.Monitoring {
+		callbacks = append(callbacks[:len(callbacks):len(callbacks)],
+			&Printer{W: os.Stdout})
+	}
+	return callbacks
+}
+
+// gradNormReporter is implemented by models that record the norms of their
+// gradients in updates, see GradNorms.
+type gradNormReporter interface {
+	GradNorms() Metrics
+}
+
+// BatchMetrics returns the metrics passed to OnBatchEnd after a mini-batch
+// of the given size: "batch_size", "learning_rate" if the model reports it
+// and the gradient norms of the update if the model records them by
+// GradNorms. Otherwise, if the model is Parameterized, "grad_norm", the L2
+// norm of all gradients, and "grad_norm/<name>", the norm of the gradient of
+// each parameter, are computed from the gradients as they were applied.
+func BatchMetrics(model interface{}, batchSize int) Metrics {
+	metrics := Metrics{"batch_size": float64(batchSize)}
+	if l, ok := model.(learningRater); ok {
+		metrics["learning_rate"] = l.LearningRate()
+	}
+	if g, ok := model.(gradNormReporter); ok && g.GradNorms() != nil {
+		for k, v := range g.GradNorms() {
+			metrics[k] = v
 		}
-		if s.Option.Monitoring {
-			fmt.Println(epoch, u.SupervisedObjective(input, target))
+	} else if p, ok := model.(Parameterized); ok {
+		sum := 0.0
+		for _, param := range p.Params() {
+			norm := GradNorm([]*Param{param})
+			metrics[gradNormKey+"/"+param.Name] = norm
+			sum += norm * norm
 		}
+		metrics[gradNormKey] = math.Sqrt(sum)
 	}
-	return nil
+	return metrics
 }
 
-func (s *Trainer) SupervisedMiniBatchTrain(u SupervisedMiniBatchUpdater,
-	input, target [][]float64) error {
-	numMiniBatches := len(input) / s.Option.MiniBatchSize
-	for epoch := 0; epoch < s.Option.Epoches; epoch++ {
-		for m := 0; m < numMiniBatches; m++ {
-			b := m * s.Option.MiniBatchSize
-			e := (m + 1) * s.Option.MiniBatchSize
-			u.SupervisedMiniBatchUpdate(input[b:e], target[b:e])
+// endEpoch computes the objective if it is needed by callbacks or observed
+// by the schedule and returns the metrics of the epoch.
+func (s *Trainer) endEpoch(epoch int, callbacks Callbacks,
+	objective func() (float64, error)) (Metrics, error) {
+	observer, observed := s.Option.Schedule.(ObjectiveObserver)
+	if len(callbacks) == 0 && !observed {
+		return nil, nil
+	}
+	value, err := objective()
+	if err != nil {
+		return nil, err
+	}
+	if observed {
+		observer.ObserveObjective(epoch, value)
+	}
+	return Metrics{"objective": value}, nil
+}
+
+// Parameterized is implemented by models that expose their trainable
+// parameters.
+type Parameterized interface {
+	Params() []*Param
+}
+
+// validation keeps track of the validation score and the best parameters.
+type validation struct {
+	option BaseTrainingOption
+	metric Metric
+	params []*Param
+	best   [][]float64
+	score  float64
+	wait   int
+	seen   bool
+}
+
+// newValidation returns nil if no validation data is given.
+func (s *Trainer) newValidation(u interface{}) (*validation, error) {
+	if s.Option.ValidationInput == nil {
+		return nil, nil
+	}
+	p, ok := u.(Parameterized)
+	if !ok {
+		return nil, errors.New("Parameters of the model can't be restored.")
+	}
+	metric := s.Option.ValidationMetric
+	if metric == nil {
+		metric = Objective{}
+	}
+	return &validation{option: s.Option, metric: metric, params: p.Params()}, nil
+}
+
+// observe scores u, adds the score to metrics and reports whether training
+// should stop.
+func (v *validation) observe(u interface{}, epoch int, metrics Metrics) bool {
+	score := v.metric.Evaluate(u, v.option.ValidationInput,
+		v.option.ValidationTarget)
+	metrics["validation_"+v.metric.Name()] = score
+
+	improved := score < v.score
+	if v.metric.Maximize() {
+		improved = score > v.score
+	}
+	if !v.seen || improved {
+		v.score, v.wait, v.seen = score, 0, true
+		if v.best == nil {
+			v.best = make([][]float64, len(v.params))
 		}
-		if s.Option.Monitoring {
-			fmt.Println(epoch, u.SupervisedObjective(input, target))
+		for i, p := range v.params {
+			v.best[i] = append(v.best[i][:0], p.Value...)
 		}
+		return false
+	}
+
+	v.wait++
+	return v.option.Patience > 0 && v.wait >= v.option.Patience
+}
+
+// restore copies the best parameters back to the model.
+func (v *validation) restore() {
+	for i, p := range v.params {
+		if v.best != nil {
+			copy(p.Value, v.best[i])
+		}
+	}
+}
+
+// checkData returns an error if n samples can't be split into mini-batches
+// of batchSize.
+func (s *Trainer) checkData(n, batchSize int) error {
+	if n == 0 {
+		return errors.New("No training data.")
+	}
+	if batchSize <= 0 {
+		return errors.New("Number of mini-batchs must be larger than zero.")
+	}
+	if batchSize > n {
+		return errors.New("Mini-batch size must not be larger than the number of data.")
+	}
+	if s.Option.Epoches <= 0 {
+		return errors.New("Epoches must be larger than zero.")
 	}
 	return nil
 }
 
-func (s *Trainer) UnSupervisedOnlineTrain(u UnSupervisedOnlineUpdater,
-	input [][]float64) error {
-	for epoch := 0; epoch < s.Option.Epoches; epoch++ {
-		for m := 0; m < len(input); m++ {
-			u.UnSupervisedOnlineUpdate(input[m])
+// order returns the order in which data is visited in epoch, or nil if it
+// is the original order. The order depends only on Seed and epoch, so that
+// resumed training visits data in the same order.
+func (s *Trainer) order(n, epoch int) []int {
+	if !s.Option.Shuffle {
+		return nil
+	}
+	return NewRand(s.Option.Seed + int64(epoch)).Perm(n)
+}
+
+// checkShapes validates in-memory data and validation data if u is a
+// ShapeValidator.
+func (s *Trainer) checkShapes(u interface{}, data Dataset) error {
+	validator, ok := u.(ShapeValidator)
+	if !ok {
+		return nil
+	}
+	if d, ok := data.(*InMemory); ok {
+		if err := validator.ValidateShape(d.Input, d.Target); err != nil {
+			return err
+		}
+	}
+	if s.Option.ValidationInput == nil {
+		return nil
+	}
+	return validator.ValidateShape(s.Option.ValidationInput,
+		s.Option.ValidationTarget)
+}
+
+// checkBatch validates a mini-batch read from data that is not in memory,
+// since such data can't be validated before training.
+func (s *Trainer) checkBatch(u interface{}, data Dataset,
+	input, target [][]float64) error {
+	validator, ok := u.(ShapeValidator)
+	if _, inMemory := data.(*InMemory); !ok || inMemory {
+		return nil
+	}
+	return validator.ValidateShape(input, target)
+}
+
+// indices returns the indices of the samples in the mini-batch from b to e
+// of an epoch visiting data in order.
+func indices(order []int, b, e int) []int {
+	if order != nil {
+		return order[b:e]
+	}
+	indices := make([]int, e-b)
+	for i := range indices {
+		indices[i] = b + i
+	}
+	return indices
+}
+
+// run splits data into mini-batches of batchSize, performs an update for
+// every mini-batch in each epoch and invokes callbacks. It returns
+// ctx.Err() before the next update once ctx is done.
+func (s *Trainer) run(ctx context.Context, u interface{}, data Dataset,
+	batchSize int, update func(epoch, batch int, input, target [][]float64) error,
+	objective func() (float64, error)) error {
+	n := data.Len()
+	if err := s.checkData(n, batchSize); err != nil {
+		return err
+	}
+	if err := s.checkSchedule(u); err != nil {
+		return err
+	}
+	if err := s.checkCheckpoint(u); err != nil {
+		return err
+	}
+	if err := s.checkShapes(u, data); err != nil {
+		return err
+	}
+	callbacks := s.callbacks()
+	v, err := s.newValidation(u)
+	if err != nil {
+		return err
+	}
+
+	start, iteration := 0, 0
+	if c := s.resumed; c != nil {
+		start, iteration = c.Epoch, c.Iteration
+		if v != nil && c.Validation != nil {
+			v.best, v.score, v.wait = c.Validation.Best, c.Validation.Score,
+				c.Validation.Wait
+			v.seen = true
 		}
-		if s.Option.Monitoring {
-			fmt.Println(epoch, u.UnSupervisedObjective(input))
+		s.resumed = nil
+	}
+
+	numBatches := (n + batchSize - 1) / batchSize
+	if s.Option.DropRemainder {
+		numBatches = n / batchSize
+	}
+
+	var metrics Metrics
+	err = func() error {
+		for epoch := start; epoch < s.Option.Epoches; epoch++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := callbacks.OnEpochBegin(u, epoch); err != nil {
+				return err
+			}
+			order := s.order(n, epoch)
+			for m := 0; m < numBatches; m++ {
+				b := m * batchSize
+				e := b + batchSize
+				if e > n {
+					e = n
+				}
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				input, target, err := data.Batch(indices(order, b, e))
+				if err != nil {
+					return err
+				}
+				if err := s.checkBatch(u, data, input, target); err != nil {
+					return err
+				}
+				s.updateLearningRate(u, epoch, iteration)
+				if err := update(epoch, m, input, target); err != nil {
+					return err
+				}
+				iteration++
+				if len(callbacks) == 0 {
+					continue
+				}
+				err = callbacks.OnBatchEnd(u, epoch, m, BatchMetrics(u, e-b))
+				if err != nil {
+					return err
+				}
+			}
+			metrics, err = s.endEpoch(epoch, callbacks, objective)
+			if err != nil {
+				return err
+			}
+			stop := false
+			if v != nil {
+				if metrics == nil {
+					metrics = Metrics{}
+				}
+				stop = v.observe(u, epoch, metrics)
+			}
+			if err := callbacks.OnEpochEnd(u, epoch, metrics); err != nil {
+				return err
+			}
+			if err := s.saveCheckpoint(u, epoch+1, iteration, v); err != nil {
+				return err
+			}
+			if stop {
+				return ErrStopTraining
+			}
 		}
+		return nil
+	}()
+	// Cancelled training also ends with the best parameters.
+	canceled := err != nil && err == ctx.Err()
+	if err != nil && err != ErrStopTraining && !canceled {
+		return err
+	}
+	if v != nil {
+		v.restore()
+	}
+
+	if endErr := callbacks.OnTrainEnd(u, metrics); endErr != nil &&
+		endErr != ErrStopTraining {
+		return endErr
+	}
+	if canceled {
+		return err
 	}
 	return nil
 }
 
-func (s *Trainer) UnSupervisedMiniBatchTrain(u UnSupervisedMiniBatchUpdater,
-	input [][]float64) error {
-	numMiniBatches := len(input) / s.Option.MiniBatchSize
-	for epoch := 0; epoch < s.Option.Epoches; epoch++ {
-		for m := 0; m < numMiniBatches; m++ {
-			b := m * s.Option.MiniBatchSize
-			e := (m + 1) * s.Option.MiniBatchSize
-			u.UnSupervisedMiniBatchUpdate(input[b:e], epoch, m)
+// datasetObjective returns the mean of objective over data read in batches
+// of batchSize, weighted by the number of samples in the batches. This is
+// the objective of the whole data for objectives that are means over
+// samples.
+func datasetObjective(data Dataset, batchSize int,
+	objective func(input, target [][]float64) float64) (float64, error) {
+	n := data.Len()
+	sum := 0.0
+	for b := 0; b < n; b += batchSize {
+		e := b + batchSize
+		if e > n {
+			e = n
 		}
-		if s.Option.Monitoring {
-			fmt.Println(epoch, u.UnSupervisedObjective(input))
+		input, target, err := data.Batch(indices(nil, b, e))
+		if err != nil {
+			return 0, err
 		}
+		sum += float64(e-b) * objective(input, target)
 	}
-	return nil
+	return sum / float64(n), nil
+}
+
+// errNoTarget is returned by supervised training on unlabeled data.
+var errNoTarget = errors.New("No target data.")
+
+func (s *Trainer) SupervisedOnlineTrain(u SupervisedOnlineUpdater,
+	input, target [][]float64) error {
+	return s.SupervisedOnlineTrainContext(context.Background(), u, input,
+		target)
+}
+
+// SupervisedOnlineTrainContext is like SupervisedOnlineTrain but stops
+// before the next update when ctx is done and returns ctx.Err().
+func (s *Trainer) SupervisedOnlineTrainContext(ctx context.Context,
+	u SupervisedOnlineUpdater, input, target [][]float64) error {
+	data, err := NewInMemory(input, target)
+	if err != nil {
+		return err
+	}
+	return s.run(ctx, u, data, 1,
+		func(epoch, m int, input, target [][]float64) error {
+			u.SupervisedOnlineUpdate(input[0], target[0])
+			return nil
+		}, func() (float64, error) {
+			return u.SupervisedObjective(input, target), nil
+		})
+}
+
+func (s *Trainer) SupervisedMiniBatchTrain(u SupervisedMiniBatchUpdater,
+	input, target [][]float64) error {
+	return s.SupervisedMiniBatchTrainContext(context.Background(), u, input,
+		target)
+}
+
+// SupervisedMiniBatchTrainContext is like SupervisedMiniBatchTrain but
+// stops before the next update when ctx is done and returns ctx.Err().
+func (s *Trainer) SupervisedMiniBatchTrainContext(ctx context.Context,
+	u SupervisedMiniBatchUpdater, input, target [][]float64) error {
+	data, err := NewInMemory(input, target)
+	if err != nil {
+		return err
+	}
+	return s.supervisedMiniBatchTrain(ctx, u, data, func() (float64, error) {
+		return u.SupervisedObjective(input, target), nil
+	})
+}
+
+// SupervisedMiniBatchTrainDataset is like SupervisedMiniBatchTrain but
+// reads mini-batches from data. The objective reported at the end of
+// epochs is averaged over mini-batches of data.
+func (s *Trainer) SupervisedMiniBatchTrainDataset(u SupervisedMiniBatchUpdater,
+	data Dataset) error {
+	return s.SupervisedMiniBatchTrainDatasetContext(context.Background(), u,
+		data)
+}
+
+// SupervisedMiniBatchTrainDatasetContext is like
+// SupervisedMiniBatchTrainDataset but stops before the next update when ctx
+// is done and returns ctx.Err().
+func (s *Trainer) SupervisedMiniBatchTrainDatasetContext(ctx context.Context,
+	u SupervisedMiniBatchUpdater, data Dataset) error {
+	return s.supervisedMiniBatchTrain(ctx, u, data, func() (float64, error) {
+		return datasetObjective(data, s.Option.MiniBatchSize,
+			u.SupervisedObjective)
+	})
+}
+
+func (s *Trainer) supervisedMiniBatchTrain(ctx context.Context,
+	u SupervisedMiniBatchUpdater, data Dataset,
+	objective func() (float64, error)) error {
+	return s.run(ctx, u, data, s.Option.MiniBatchSize,
+		func(epoch, m int, input, target [][]float64) error {
+			if target == nil {
+				return errNoTarget
+			}
+			u.SupervisedMiniBatchUpdate(input, target)
+			return nil
+		}, objective)
+}
+
+func (s *Trainer) UnSupervisedOnlineTrain(u UnSupervisedOnlineUpdater,
+	input [][]float64) error {
+	return s.UnSupervisedOnlineTrainContext(context.Background(), u, input)
+}
+
+// UnSupervisedOnlineTrainContext is like UnSupervisedOnlineTrain but stops
+// before the next update when ctx is done and returns ctx.Err().
+func (s *Trainer) UnSupervisedOnlineTrainContext(ctx context.Context,
+	u UnSupervisedOnlineUpdater, input [][]float64) error {
+	return s.run(ctx, u, &InMemory{Input: input}, 1,
+		func(epoch, m int, input, target [][]float64) error {
+			u.UnSupervisedOnlineUpdate(input[0])
+			return nil
+		}, func() (float64, error) {
+			return u.UnSupervisedObjective(input), nil
+		})
+}
+
+// UnSupervisedMiniBatchTrain passes the index of mini-batches to u. The
+// mini-batch m consists of the samples at the positions from
+// m*MiniBatchSize in the (possibly shuffled) order of the epoch.
+func (s *Trainer) UnSupervisedMiniBatchTrain(u UnSupervisedMiniBatchUpdater,
+	input [][]float64) error {
+	return s.UnSupervisedMiniBatchTrainContext(context.Background(), u, input)
+}
+
+// UnSupervisedMiniBatchTrainContext is like UnSupervisedMiniBatchTrain but
+// stops before the next update when ctx is done and returns ctx.Err().
+func (s *Trainer) UnSupervisedMiniBatchTrainContext(ctx context.Context,
+	u UnSupervisedMiniBatchUpdater, input [][]float64) error {
+	return s.unSupervisedMiniBatchTrain(ctx, u, &InMemory{Input: input},
+		func() (float64, error) {
+			return u.UnSupervisedObjective(input), nil
+		})
+}
+
+// UnSupervisedMiniBatchTrainDataset is like UnSupervisedMiniBatchTrain but
+// reads mini-batches from data. Targets of data are ignored. The objective
+// reported at the end of epochs is averaged over mini-batches of data.
+func (s *Trainer) UnSupervisedMiniBatchTrainDataset(
+	u UnSupervisedMiniBatchUpdater, data Dataset) error {
+	return s.UnSupervisedMiniBatchTrainDatasetContext(context.Background(), u,
+		data)
+}
+
+// UnSupervisedMiniBatchTrainDatasetContext is like
+// UnSupervisedMiniBatchTrainDataset but stops before the next update when
+// ctx is done and returns ctx.Err().
+func (s *Trainer) UnSupervisedMiniBatchTrainDatasetContext(
+	ctx context.Context, u UnSupervisedMiniBatchUpdater, data Dataset) error {
+	return s.unSupervisedMiniBatchTrain(ctx, u, data, func() (float64, error) {
+		return datasetObjective(data, s.Option.MiniBatchSize,
+			func(input, target [][]float64) float64 {
+				return u.UnSupervisedObjective(input)
+			})
+	})
+}
+
+func (s *Trainer) unSupervisedMiniBatchTrain(ctx context.Context,
+	u UnSupervisedMiniBatchUpdater, data Dataset,
+	objective func() (float64, error)) error {
+	return s.run(ctx, u, data, s.Option.MiniBatchSize,
+		func(epoch, m int, input, target [][]float64) error {
+			u.UnSupervisedMiniBatchUpdate(input, epoch, m)
+			return nil
+		}, objective)
 }